@@ -0,0 +1,3 @@
+module github.com/masayukioguni/go_interface_sample
+
+go 1.21
@@ -0,0 +1,223 @@
+/*
+Package iface は、 main.go のサンプルで使うインタフェースとその実装を、
+他のパッケージからも import して使えるようにまとめたもの。
+
+Accessor と Document を中心に、埋め込みによる継承(Page)と
+オーバーライド(ExtendedPage)、 Any を使った GetValuer を含む。
+*/
+package iface
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Interface を宣言
+type Accessor interface {
+	GetText() string
+	SetText(string)
+}
+
+// Accessor を満たす実装
+// Interface の持つメソッド群を実装していれば、
+// Interface を満たす(satisfy) といえる。
+// 明示的な宣言は必要なく、実装と完全に分離している。
+type Document struct {
+	text string
+}
+
+func NewDocument(text string) *Document {
+	return &Document{text: text}
+}
+
+func (d *Document) GetText() string {
+	return d.text
+}
+
+func (d *Document) SetText(text string) {
+	d.text = text
+}
+
+// 新しい Document を作って返す。
+// 今は text だけなのでただのコピーで足りるが、
+// フィールドが増えても複製はここに集約する。
+func (d *Document) Clone() *Document {
+	return &Document{text: d.text}
+}
+
+// map のキーに使うための文字列を返す。
+// ポインタはインスタンスごとに違うので、 text をそのままキーにする。
+// 同じ text の Document は同じキーになる。
+func (d *Document) Key() string {
+	return d.text
+}
+
+// SetText の結果を返してメソッドチェーンできるようにしたもの。
+// Accessor のシグネチャは変えずに、別のインタフェースとして定義する。
+type FluentAccessor interface {
+	Accessor
+	WithText(string) FluentAccessor
+}
+
+func (d *Document) WithText(text string) FluentAccessor {
+	d.SetText(text)
+	return d
+}
+
+////////////////////////////
+
+type Page struct {
+	Document // 匿名型を含むと、その型のメソッドが継承(というか mixin)される
+	Page     int
+}
+
+func NewPage(text string, page int) *Page {
+	return &Page{Document{text}, page}
+}
+
+// 埋め込んだ Document の Clone() をそのまま使うと *Document が返って
+// Page が落ちてしまうので、 Page でも定義し直す。
+func (p *Page) Clone() *Page {
+	return &Page{*p.Document.Clone(), p.Page}
+}
+
+// WithText も同じく、 *Document を返されると Page として続けられないので定義し直す。
+func (p *Page) WithText(text string) FluentAccessor {
+	p.SetText(text)
+	return p
+}
+
+////////////////////////////
+
+// Accessor をみたいしていれば、 Get, Set できる
+func SetAndGet(acsr Accessor) {
+	acsr.SetText("accessor")
+	fmt.Println(acsr.GetText())
+}
+
+////////////////////////////
+
+// Override
+// Document の GetText() を上書きした Page
+type ExtendedPage struct {
+	Document
+	Page   int
+	Format string // GetText() の書式。空なら DefaultPageFormat
+}
+
+const DefaultPageFormat = "%d : %s"
+
+func NewExtendedPage(text string, page int) *ExtendedPage {
+	return &ExtendedPage{Document: Document{text}, Page: page}
+}
+
+// Document.GetText() のオーバーライド
+func (ep *ExtendedPage) GetText() string {
+	format := ep.Format
+	if format == "" {
+		format = DefaultPageFormat
+	}
+	return fmt.Sprintf(format, ep.Page, ep.Document.GetText())
+}
+
+// text は非公開なので、 JSON の形を別の struct で受けてから SetText する
+func (ep *ExtendedPage) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Page int    `json:"page"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	ep.Page = v.Page
+	ep.SetText(v.Text)
+	return nil
+}
+
+// Page と同じく、 Page と Format も含めて複製する。
+func (ep *ExtendedPage) Clone() *ExtendedPage {
+	return &ExtendedPage{Document: *ep.Document.Clone(), Page: ep.Page, Format: ep.Format}
+}
+
+// 埋め込んだ Document の WithText() だと、返り値の GetText() が
+// オーバーライドしたものにならないので、 ep 自身を返す。
+func (ep *ExtendedPage) WithText(text string) FluentAccessor {
+	ep.SetText(text)
+	return ep
+}
+
+// オーバーライドした GetText() ではなく、
+// 埋め込んだ Document の text をそのまま返す。
+func (ep *ExtendedPage) BaseText() string {
+	return ep.Document.GetText()
+}
+
+// 満たしているかは使った箇所でしかチェックされないので、
+// 変更で気づかないうちに満たさなくならないよう、
+// nil ポインタを代入してコンパイル時に確認しておく。
+var _ Accessor = (*Document)(nil)
+var _ Accessor = (*Page)(nil)
+var _ Accessor = (*ExtendedPage)(nil)
+var _ FluentAccessor = (*Document)(nil)
+var _ FluentAccessor = (*Page)(nil)
+var _ FluentAccessor = (*ExtendedPage)(nil)
+
+////////////////////////////
+
+// Get() があるかを調べる
+// er を付ける命名が慣習
+type Getter interface {
+	GetText() string
+}
+
+////////////////////////////
+
+// 全ての型を許容するインタフェースのようなものを作っておく
+type Any interface{}
+
+// ジェネリクス的な
+type GetValuer interface {
+	GetValue() Any
+}
+
+// Accessor と同じく、 Set 側も用意しておく
+type SetValuer interface {
+	SetValue(Any)
+}
+
+// インタフェースは埋め込んで組み合わせられる
+type GetSetValuer interface {
+	GetValuer
+	SetValuer
+}
+
+// Any 型で実装
+type Value struct {
+	v Any
+}
+
+func NewValue(v Any) *Value {
+	return &Value{v}
+}
+
+// GetValuer を実装
+func (v *Value) GetValue() Any {
+	return v.v
+}
+
+// SetValuer を実装
+func (v *Value) SetValue(a Any) {
+	v.v = a
+}
+
+// 中に入っている値の型名を返す
+func (v *Value) TypeName() string {
+	if v.v == nil {
+		return "<nil>"
+	}
+	return reflect.TypeOf(v.v).String()
+}
+
+var _ GetValuer = (*Value)(nil)
+var _ GetSetValuer = (*Value)(nil)
@@ -0,0 +1,229 @@
+package iface_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/masayukioguni/go_interface_sample/iface"
+)
+
+func TestSetAndGet(t *testing.T) {
+	tests := []struct {
+		name string
+		acsr iface.Accessor
+		want string
+	}{
+		{"Document", &iface.Document{}, "accessor"},
+		{"Page", &iface.Page{Page: 1}, "accessor"},
+		{"ExtendedPage", &iface.ExtendedPage{Page: 2}, "2 : accessor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iface.SetAndGet(tt.acsr)
+			if got := tt.acsr.GetText(); got != tt.want {
+				t.Errorf("GetText() after SetAndGet = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func ExampleSetAndGet() {
+	iface.SetAndGet(&iface.Document{})
+	iface.SetAndGet(&iface.Page{})
+	iface.SetAndGet(&iface.ExtendedPage{Page: 3})
+	// Output:
+	// accessor
+	// accessor
+	// 3 : accessor
+}
+
+func TestDocumentClone(t *testing.T) {
+	doc := iface.NewDocument("original")
+	clone := doc.Clone()
+	if clone == doc {
+		t.Fatal("Clone returned the same pointer")
+	}
+	if got := clone.GetText(); got != "original" {
+		t.Errorf("clone.GetText() = %q, want %q", got, "original")
+	}
+
+	clone.SetText("changed")
+	if got := doc.GetText(); got != "original" {
+		t.Errorf("original changed to %q after modifying the clone", got)
+	}
+}
+
+func TestExtendedPageClone(t *testing.T) {
+	ep := iface.NewExtendedPage("original", 2)
+	clone := ep.Clone()
+	if clone == ep {
+		t.Fatal("Clone returned the same pointer")
+	}
+	if clone.Page != 2 {
+		t.Errorf("clone.Page = %d, want 2", clone.Page)
+	}
+	if got, want := clone.GetText(), ep.GetText(); got != want {
+		t.Errorf("clone.GetText() = %q, want %q", got, want)
+	}
+
+	clone.SetText("changed")
+	if got := ep.GetText(); got != "2 : original" {
+		t.Errorf("original changed to %q after modifying the clone", got)
+	}
+}
+
+func TestPageClone(t *testing.T) {
+	p := iface.NewPage("original", 1)
+	clone := p.Clone()
+	if clone.Page != 1 || clone.GetText() != "original" {
+		t.Errorf("clone = {%d %q}, want {1 \"original\"}", clone.Page, clone.GetText())
+	}
+}
+
+func TestValueSetValue(t *testing.T) {
+	var gs iface.GetSetValuer = iface.NewValue(10)
+	if got := gs.GetValue(); got != 10 {
+		t.Fatalf("GetValue() = %v, want 10", got)
+	}
+	gs.SetValue("vvv")
+	if got := gs.GetValue(); got != "vvv" {
+		t.Errorf("GetValue() after SetValue = %v, want %q", got, "vvv")
+	}
+}
+
+func TestDocumentWithText(t *testing.T) {
+	doc := iface.NewDocument("")
+	if got := doc.WithText("a").GetText(); got != "a" {
+		t.Errorf("WithText(%q).GetText() = %q", "a", got)
+	}
+	if got := doc.WithText("b").WithText("c").GetText(); got != "c" {
+		t.Errorf("chained WithText = %q, want %q", got, "c")
+	}
+	if got := doc.GetText(); got != "c" {
+		t.Errorf("receiver text = %q, want %q", got, "c")
+	}
+}
+
+func TestExtendedPageWithText(t *testing.T) {
+	var f iface.FluentAccessor = iface.NewExtendedPage("x", 2)
+	chained := f.WithText("a")
+	if _, ok := chained.(*iface.ExtendedPage); !ok {
+		t.Fatalf("WithText returned %T, want *iface.ExtendedPage", chained)
+	}
+	if got := chained.WithText("b").GetText(); got != "2 : b" {
+		t.Errorf("chained WithText = %q, want %q", got, "2 : b")
+	}
+}
+
+func TestDocumentKey(t *testing.T) {
+	groups := map[string][]*iface.Document{}
+	for _, text := range []string{"a", "b", "a", "a"} {
+		d := iface.NewDocument(text)
+		groups[d.Key()] = append(groups[d.Key()], d)
+	}
+	if len(groups) != 2 {
+		t.Errorf("len(groups) = %d, want 2", len(groups))
+	}
+	if n := len(groups["a"]); n != 3 {
+		t.Errorf("len(groups[a]) = %d, want 3", n)
+	}
+	if n := len(groups["b"]); n != 1 {
+		t.Errorf("len(groups[b]) = %d, want 1", n)
+	}
+}
+
+// iface.go の中の確認に加えて、パッケージの外から見ても満たしていることを
+// コンパイル時に確認する。このファイルがコンパイルできれば満たしている。
+var (
+	_ iface.Accessor     = (*iface.Document)(nil)
+	_ iface.Accessor     = (*iface.Page)(nil)
+	_ iface.Accessor     = (*iface.ExtendedPage)(nil)
+	_ iface.GetValuer    = (*iface.Value)(nil)
+	_ iface.GetSetValuer = (*iface.Value)(nil)
+)
+
+func TestConstructors(t *testing.T) {
+	tests := []struct {
+		name string
+		acsr iface.Accessor
+		want string
+	}{
+		{"NewDocument", iface.NewDocument("doc"), "doc"},
+		{"NewPage", iface.NewPage("page", 1), "page"},
+		{"NewExtendedPage", iface.NewExtendedPage("page", 2), "2 : page"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.acsr.GetText(); got != tt.want {
+				t.Errorf("GetText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := iface.NewPage("page", 7).Page; got != 7 {
+		t.Errorf("NewPage(...).Page = %d, want 7", got)
+	}
+}
+
+func TestExtendedPageBaseText(t *testing.T) {
+	ep := iface.NewExtendedPage("", 2)
+	ep.SetText("page")
+	if got := ep.BaseText(); got != "page" {
+		t.Errorf("BaseText() = %q, want %q", got, "page")
+	}
+	if got := ep.GetText(); got != "2 : page" {
+		t.Errorf("GetText() = %q, want %q", got, "2 : page")
+	}
+}
+
+func TestExtendedPageFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		want   string
+	}{
+		{"default", "", "2 : page"},
+		{"custom", "[%d] %s", "[2] page"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := iface.NewExtendedPage("page", 2)
+			ep.Format = tt.format
+			if got := ep.GetText(); got != tt.want {
+				t.Errorf("GetText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValueTypeName(t *testing.T) {
+	type point struct{ X, Y int }
+	tests := []struct {
+		v    iface.Any
+		want string
+	}{
+		{10, "int"},
+		{"vvv", "string"},
+		{point{2, 3}, "iface_test.point"},
+		{nil, "<nil>"},
+	}
+	for _, tt := range tests {
+		if got := iface.NewValue(tt.v).TypeName(); got != tt.want {
+			t.Errorf("NewValue(%#v).TypeName() = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestExtendedPageUnmarshalJSON(t *testing.T) {
+	var ep iface.ExtendedPage
+	if err := json.Unmarshal([]byte(`{"page": 2, "text": "page"}`), &ep); err != nil {
+		t.Fatal(err)
+	}
+	if got := ep.GetText(); got != "2 : page" {
+		t.Errorf("GetText() = %q, want %q", got, "2 : page")
+	}
+
+	if err := json.Unmarshal([]byte(`{"page": "two"}`), &ep); err == nil {
+		t.Error("json.Unmarshal accepted a string page")
+	}
+}
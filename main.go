@@ -14,11 +14,25 @@ http://www.softwareresearch.net/fileadmin/src/docs/teaching/SS10/Sem/Paper__aign
 */
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
 	"reflect"
+	"runtime"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/masayukioguni/go_interface_sample/iface"
 )
 
 // 基本的な Struct
@@ -30,12 +44,75 @@ type Point struct {
 // Struct のメソッド
 func (p Point) Coordinate() string {
 	// p がレシーバ
+	return p.String()
+}
+
+// fmt.Stringer を実装
+// fmt.Println(p) や %v でもこの形式で出力される。
+func (p Point) String() string {
 	return fmt.Sprintf("(%d, %d)", p.X, p.Y)
 }
 
+// レシーバも引数も値渡しなので、
+// 元の Point は変更されず新しい Point が返る。
+func (p Point) Add(q Point) Point {
+	return Point{p.X + q.X, p.Y + q.Y}
+}
+
+func (p Point) Sub(q Point) Point {
+	return Point{p.X - q.X, p.Y - q.Y}
+}
+
+func (p Point) Scale(k int) Point {
+	return Point{p.X * k, p.Y * k}
+}
+
+// X, Y は int だが、距離は float64 で返す。
+// 同じ点同士なら math.Hypot(0, 0) なのでちょうど 0 になる。
+func (p Point) Distance(q Point) float64 {
+	return math.Hypot(float64(p.X-q.X), float64(p.Y-q.Y))
+}
+
+// 全ての点を囲む長方形の、左下(min)と右上(max)の角を返す。
+// 点が無ければ ok は false になる。
+func BoundingBox(points []Point) (min, max Point, ok bool) {
+	if len(points) == 0 {
+		return Point{}, Point{}, false
+	}
+	min, max = points[0], points[0]
+	for _, p := range points[1:] {
+		if p.X < min.X {
+			min.X = p.X
+		}
+		if p.Y < min.Y {
+			min.Y = p.Y
+		}
+		if p.X > max.X {
+			max.X = p.X
+		}
+		if p.Y > max.Y {
+			max.Y = p.Y
+		}
+	}
+	return min, max, true
+}
+
 func main1() {
 	var a Point = Point{2, 3}
 	fmt.Println(a.Coordinate()) // (2, 3)
+	fmt.Println(a)              // (2, 3)
+
+	var b Point = Point{1, 1}
+	fmt.Println(a.Add(b).Coordinate())   // (3, 4)
+	fmt.Println(a.Sub(b).Coordinate())   // (1, 2)
+	fmt.Println(a.Scale(2).Coordinate()) // (4, 6)
+	fmt.Println(a.Coordinate())          // (2, 3) a は変わらない
+
+	fmt.Println(Point{0, 0}.Distance(Point{3, 4})) // 5
+	fmt.Println(a.Distance(a))                     // 0
+
+	fmt.Println(BoundingBox([]Point{{2, 3}, {-1, 5}, {4, 0}})) // (-1, 0) (4, 5) true
+	fmt.Println(BoundingBox(nil))                              // (0, 0) (0, 0) false
 }
 
 ////////////////////////////
@@ -45,13 +122,31 @@ type trimmedString string
 
 // そこにメソッドも追加できる。
 func (t trimmedString) trim() trimmedString {
-	return t[:3]
+	return t.TrimTo(3)
+}
+
+// 先頭の n 文字を返す。
+// バイトではなく rune 単位で切るので日本語でも壊れず、
+// n が文字数より大きい場合はそのまま返す。
+func (t trimmedString) TrimTo(n int) trimmedString {
+	r := []rune(string(t))
+	if n > len(r) {
+		n = len(r)
+	}
+	if n < 0 {
+		n = 0
+	}
+	return trimmedString(r[:n])
 }
 
 func main2() {
 	var t trimmedString = "abcdefg"
 	fmt.Println(t.trim())
 
+	// 短い文字列やマルチバイト文字でも panic しない
+	fmt.Println(trimmedString("ab").trim())   // ab
+	fmt.Println(trimmedString("漢字表記").trim()) // 漢字表
+
 	// 型変換
 	var s string = string(t)
 
@@ -62,27 +157,31 @@ func main2() {
 
 ////////////////////////////
 
-// Interface を宣言
-type Accessor interface {
-	GetText() string
-	SetText(string)
-}
-
-// Accessor を満たす実装
-// Interface の持つメソッド群を実装していれば、
-// Interface を満たす(satisfy) といえる。
-// 明示的な宣言は必要なく、実装と完全に分離している。
-type Document struct {
-	text string
-}
+// Accessor や Document などは import して使えるよう iface パッケージに移した。
+// このファイルのサンプルは元の名前のまま書けるように、別名を付けておく。
+type (
+	Accessor       = iface.Accessor
+	FluentAccessor = iface.FluentAccessor
+	Document       = iface.Document
+	Page           = iface.Page
+	ExtendedPage   = iface.ExtendedPage
+	Getter         = iface.Getter
+	Any            = iface.Any
+	GetValuer      = iface.GetValuer
+	SetValuer      = iface.SetValuer
+	GetSetValuer   = iface.GetSetValuer
+	Value          = iface.Value
+)
 
-func (d *Document) GetText() string {
-	return d.text
-}
+const DefaultPageFormat = iface.DefaultPageFormat
 
-func (d *Document) SetText(text string) {
-	d.text = text
-}
+var (
+	NewDocument     = iface.NewDocument
+	NewPage         = iface.NewPage
+	NewExtendedPage = iface.NewExtendedPage
+	NewValue        = iface.NewValue
+	SetAndGet       = iface.SetAndGet
+)
 
 func main3() {
 	// Document のインスタンスを直接変更しても
@@ -97,13 +196,39 @@ func main3() {
 	var acsr Accessor = &Document{}
 	acsr.SetText("accessor")
 	fmt.Println(acsr.GetText())
+
+	// Clone したものを変更しても元の doc は変わらない
+	clone := doc.Clone()
+	clone.SetText("clone")
+	fmt.Println(doc.GetText(), clone.GetText()) // document clone
+
+	fmt.Println(doc.WithText("a").GetText()) // a
+
+	// Key() でまとめる
+	groups := map[string][]*Document{}
+	for _, text := range []string{"a", "b", "a"} {
+		d := NewDocument(text)
+		groups[d.Key()] = append(groups[d.Key()], d)
+	}
+	fmt.Println(len(groups["a"]), len(groups["b"])) // 2 1
+
+	// コンストラクタを使えば SetText を呼ばずに済む
+	fmt.Println(NewDocument("new").GetText()) // new
 }
 
 ////////////////////////////
 
-type Page struct {
-	Document // 匿名型を含むと、その型のメソッドが継承(というか mixin)される
-	Page     int
+// from の型の値を、 to の型の変数に代入できるかを調べる。
+//
+// interface{} で受け取るので、比べられるのは動的な型同士になる。
+// to に Accessor 型の変数を渡しても中身の *Document などになってしまうので、
+// interface を満たすかは Implements で reflect.Type を渡して調べる。
+func AssignableTo(from, to interface{}) bool {
+	ft, tt := reflect.TypeOf(from), reflect.TypeOf(to)
+	if ft == nil || tt == nil {
+		return false
+	}
+	return ft.AssignableTo(tt)
 }
 
 func main4() {
@@ -116,9 +241,16 @@ func main4() {
 	acsr.SetText("page")
 	fmt.Println(acsr.GetText())
 
+	fmt.Println(NewPage("new page", 1).GetText()) // new page
+
 	// Document と Page の間に代入可能な関係は無い
 	// var page Page = Document{}
 	// var doc Document = Page{}
+
+	fmt.Println(AssignableTo(Document{}, Page{}))     // false
+	fmt.Println(AssignableTo(Page{}, Document{}))     // false
+	fmt.Println(AssignableTo(Document{}, Document{})) // true
+	fmt.Println(AssignableTo(&Document{}, &Page{}))   // false
 }
 
 ////////////////////////////
@@ -133,43 +265,120 @@ func main4() {
 	コンパイル時にチェックできる。
 
 	Accessor をみたいしていれば、 Get, Set できるという例。
+	(SetAndGet は iface パッケージにある)
 */
 
-func SetAndGet(acsr Accessor) {
-	acsr.SetText("accessor")
-	fmt.Println(acsr.GetText())
+// 関数の組で Accessor を満たす。
+// http.HandlerFunc と同じく、 struct を定義しなくても Accessor として渡せる。
+type accessorFunc struct {
+	get func() string
+	set func(string)
+}
+
+func (a accessorFunc) GetText() string     { return a.get() }
+func (a accessorFunc) SetText(text string) { a.set(text) }
+
+func AccessorFunc(get func() string, set func(string)) Accessor {
+	return accessorFunc{get, set}
+}
+
+// 各 Accessor の GetText() を sep でつなげる
+func Concat(sep string, accessors ...Accessor) string {
+	texts := make([]string, len(accessors))
+	for i, acsr := range accessors {
+		texts[i] = acsr.GetText()
+	}
+	return strings.Join(texts, sep)
+}
+
+// 全ての Accessor に同じ text を SetText する
+func SetAll(text string, accessors ...Accessor) {
+	for _, acsr := range accessors {
+		acsr.SetText(text)
+	}
+}
+
+// GetText() が pred を満たす、最初の Accessor を返す
+func FindFirst(accessors []Accessor, pred func(string) bool) (Accessor, bool) {
+	for _, acsr := range accessors {
+		if pred(acsr.GetText()) {
+			return acsr, true
+		}
+	}
+	return nil, false
 }
 
 func main5() {
 	// どちらも Accessor として振る舞える
 	SetAndGet(&Page{})
 	SetAndGet(&Document{})
+
+	// 関数だけでも Accessor として振る舞える
+	var text string
+	SetAndGet(AccessorFunc(
+		func() string { return "func " + text },
+		func(t string) { text = t },
+	)) // func accessor
+
+	// 可変長引数でまとめて受け取れる
+	fmt.Printf("%q\n", Concat(", "))                                                             // ""
+	fmt.Printf("%q\n", Concat(", ", NewDocument("a")))                                           // "a"
+	fmt.Printf("%q\n", Concat(", ", NewDocument("a"), NewPage("b", 1), NewExtendedPage("c", 2))) // "a, b, 2 : c"
+
+	accessors := []Accessor{NewDocument("doc"), NewExtendedPage("page", 1), NewDocument("page")}
+	found, ok := FindFirst(accessors, func(text string) bool {
+		return strings.Contains(text, "page")
+	})
+	fmt.Println(found.GetText(), ok) // 1 : page true
+
+	doc, page := &Document{}, &Page{}
+	SetAll("all", doc, page)
+	fmt.Println(doc.GetText(), page.GetText()) // all all
 }
 
 ////////////////////////////
 
 /*
 	Override
+	ExtendedPage は iface パッケージにある。
 */
-type ExtendedPage struct {
-	Document
-	Page int
-}
 
-// Document.GetText() のオーバーライド
-func (ep *ExtendedPage) GetText() string {
-	// int -> string は strconv.Itoa 使用
-	return strconv.Itoa(ep.Page) + " : " + ep.Document.GetText()
+// Accessor 同士を GetText() の結果で比較する。
+// ExtendedPage のようにオーバーライドされていれば、その結果が使われる。
+func AccessorEqual(a, b Accessor) bool {
+	return a.GetText() == b.GetText()
 }
 
 func main6() {
 	// Accessor を実装している
 	var acsr Accessor = &ExtendedPage{
-		Document{},
-		2,
+		Document: Document{},
+		Page:     2,
 	}
 	acsr.SetText("page")
-	fmt.Println(acsr.GetText()) // 2 : page
+	fmt.Println(acsr.GetText())                        // 2 : page
+	fmt.Println(NewExtendedPage("page", 2).GetText())  // 2 : page
+	fmt.Println(NewExtendedPage("page", 2).BaseText()) // page
+
+	// Format で書式を変えられる
+	custom := NewExtendedPage("page", 2)
+	custom.Format = "[%d] %s"
+	fmt.Println(custom.GetText()) // [2] page
+
+	// JSON からも作れる
+	var decoded ExtendedPage
+	if err := json.Unmarshal([]byte(`{"page": 2, "text": "page"}`), &decoded); err != nil {
+		panic(err)
+	}
+	fmt.Println(decoded.GetText()) // 2 : page
+
+	// GetText() で比べるので、オーバーライドされた結果で比較される
+	doc := &Document{}
+	doc.SetText("page")
+	page := &Page{}
+	page.SetText("page")
+	fmt.Println(AccessorEqual(doc, page)) // true
+	fmt.Println(AccessorEqual(doc, acsr)) // false
 }
 
 ////////////////////////////
@@ -200,17 +409,45 @@ func main6() {
 	参考 http://golang.org/doc/effective_go.html#interface_conversions
 */
 
-// Get() があるかを調べる
-// er を付ける命名が慣習
-type Getter interface {
-	GetText() string
+// GetText だけを持つラッパー
+type frozenAccessor struct {
+	a Accessor
+}
+
+func (f frozenAccessor) GetText() string {
+	return f.a.GetText()
+}
+
+// a を読み取り専用の Getter にする。
+// a をそのまま Getter として返すと型アサーションで Accessor に戻せてしまうので、
+// SetText を持たない型で包んで、意図的に SetText を落とす。
+func Freeze(a Accessor) Getter {
+	return frozenAccessor{a}
+}
+
+// v が Getter を実装していれば、 Getter 型にして返す。
+//
+// interface への型アサーションは、ランタイムが (interface, 動的な型) の組ごとに
+// 結果をキャッシュしているので、同じ型の値を何度アサーションしても
+// 2 回目以降はハッシュを引くだけで済む。
+// reflect.Type ごとに結果を覚えておくような仕組みを自前で用意しても、
+// reflect やロックの分だけ遅くなる(BenchmarkAsGetter の cache を参照)。
+func AsGetter(v interface{}) (Getter, bool) {
+	g, ok := v.(Getter)
+	return g, ok
+}
+
+// v が Getter を実装しているかだけを返す。
+func IsGetter(v interface{}) bool {
+	_, ok := v.(Getter)
+	return ok
 }
 
 func dynamicIf(v interface{}) string {
 	// v は Interface 型
 
 	var result string
-	g, ok := v.(Getter) // v が Get() を実装しているか調べる
+	g, ok := AsGetter(v) // v が Get() を実装しているか調べる
 	if ok {
 		result = g.GetText()
 	} else {
@@ -234,10 +471,70 @@ func dynamicSwitch(v interface{}) string {
 	return result
 }
 
+// dynamicSwitch と同じ結果を返すが、どの case に当たったかを logf に出力する
+func DescribeVerbose(v interface{}, logf func(string, ...interface{})) string {
+	switch checked := v.(type) {
+	case Getter:
+		logf("matched Getter")
+		return checked.GetText()
+	case string:
+		logf("matched string")
+		return "not implemented"
+	default:
+		logf("no match for type %T", v)
+		return ""
+	}
+}
+
+// 型アサーションをジェネリクスで書いたもの。
+// comma ok の形と同じく、失敗しても panic しない。
+func TryAssert[T any](v interface{}) (T, bool) {
+	t, ok := v.(T)
+	return t, ok
+}
+
+// 失敗したら、欲しかった型と実際の型を含めて panic する。
+// v.(T) をそのまま書いたときの panic よりわかりやすい。
+func MustAssert[T any](v interface{}) T {
+	t, ok := v.(T)
+	if !ok {
+		want := reflect.TypeOf((*T)(nil)).Elem()
+		panic(fmt.Sprintf("MustAssert: want %v, got %v", want, reflect.TypeOf(v)))
+	}
+	return t
+}
+
+// dynamicSwitch を組み込み型にも広げたもの。
+// どの case にも当たらない場合は reflect で型名を返す。
+func Describe(v interface{}) string {
+	switch checked := v.(type) {
+	case nil:
+		// 型も値も持たない interface{} は nil の case に当たる
+		return "nil"
+	case Getter:
+		// nil ポインタの *ExtendedPage なども Getter の case に当たるので、
+		// GetText() を呼ぶ前に中身を確かめる
+		if IsNil(checked) {
+			return "Getter: <nil>"
+		}
+		return "Getter: " + checked.GetText()
+	case string:
+		return "string: " + checked
+	case int:
+		return "int: " + strconv.Itoa(checked)
+	case float64:
+		return "float64: " + strconv.FormatFloat(checked, 'g', -1, 64)
+	case bool:
+		return "bool: " + strconv.FormatBool(checked)
+	default:
+		return "unknown: " + reflect.TypeOf(v).String()
+	}
+}
+
 func main7() {
 	var ep *ExtendedPage = &ExtendedPage{
-		Document{},
-		3,
+		Document: Document{},
+		Page:     3,
 	}
 	ep.SetText("page")
 
@@ -249,32 +546,218 @@ func main7() {
 	// 型スイッチを使う場合
 	fmt.Println(dynamicSwitch(ep))       // 3 : page
 	fmt.Println(dynamicSwitch("string")) // not implemented
+
+	fmt.Println(IsGetter(ep), IsGetter("string")) // true false
+
+	// Freeze したものは Accessor には戻せない
+	frozen := Freeze(ep)
+	_, ok := frozen.(Accessor)
+	fmt.Println(frozen.GetText(), ok) // 3 : page false
+
+	// Describe は組み込み型も見分ける
+	for _, v := range []interface{}{ep, "string", 1, 1.5, true, nil, Point{2, 3}} {
+		fmt.Println(Describe(v))
+	}
+	// Getter: 3 : page
+	// string: string
+	// int: 1
+	// float64: 1.5
+	// bool: true
+	// nil
+	// unknown: main.Point
+
+	// どの case に当たったかを記録する
+	var logs []string
+	logf := func(format string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}
+	DescribeVerbose(ep, logf)
+	DescribeVerbose(1, logf)
+	fmt.Println(logs) // [matched Getter no match for type int]
+
+	// ジェネリクス版の型アサーション
+	fmt.Println(MustAssert[Getter](ep).GetText()) // 3 : page
+	fmt.Println(TryAssert[Getter]("string"))      // <nil> false
+	func() {
+		defer func() {
+			fmt.Println(recover()) // MustAssert: want iface.Getter, got <nil>
+		}()
+		MustAssert[Getter](nil)
+	}()
 }
 
 ////////////////////////////
 
-// 全ての型を許容するインタフェースのようなものを作っておく
-type Any interface{}
+// 値をそれぞれ *Value で包んで []GetValuer にする
+func Values(vs ...Any) []GetValuer {
+	values := make([]GetValuer, len(vs))
+	for i, v := range vs {
+		values[i] = NewValue(v)
+	}
+	return values
+}
+
+// ジェネリクスが使えるなら、型パラメータで値を持てば
+// 取り出す側で型アサーションをする必要がない。
+type TypedValue[T any] struct {
+	v T
+}
+
+func (t TypedValue[T]) Get() T {
+	return t.v
+}
+
+// GetValue() の結果をキャッシュするラッパー
+type memoizedValue struct {
+	g    GetValuer
+	once sync.Once
+	v    Any
+}
+
+func (m *memoizedValue) GetValue() Any {
+	m.once.Do(func() {
+		m.v = m.g.GetValue()
+	})
+	return m.v
+}
+
+// g の GetValue() を最初の一回だけ呼び、以降はその結果を返す GetValuer を返す。
+// 元と同じ GetValuer なので、呼ぶ側は何も変えなくてよい。
+func Memoize(g GetValuer) GetValuer {
+	return &memoizedValue{g: g}
+}
+
+// 名前を付けて値を持ち、入れた順番も覚えておくコレクション。
+// map だけでは順番が保証されないので、キーの順番は slice で持つ。
+// ゼロ値のまま使える。
+type OrderedValues struct {
+	keys   []string
+	values map[string]Any
+}
+
+// 既にあるキーなら値だけを上書きし、順番は変えない。
+func (o *OrderedValues) Set(key string, v Any) {
+	if o.values == nil {
+		o.values = map[string]Any{}
+	}
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+func (o *OrderedValues) Get(key string) (Any, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// 入れた順番のキーを返す
+func (o *OrderedValues) Keys() []string {
+	keys := make([]string, len(o.keys))
+	copy(keys, o.keys)
+	return keys
+}
+
+// needle と reflect.DeepEqual で等しい最初の要素の位置を返す。無ければ -1。
+// Any は == で比べると、比較できない型(slice など)で panic するので DeepEqual を使う。
+func IndexOfAny(haystack []Any, needle Any) int {
+	for i, v := range haystack {
+		if reflect.DeepEqual(v, needle) {
+			return i
+		}
+	}
+	return -1
+}
+
+func ContainsAny(haystack []Any, needle Any) bool {
+	return IndexOfAny(haystack, needle) >= 0
+}
+
+// GetValue() の値が pred を満たすものと満たさないものに分ける。
+// それぞれの中の順番は元のまま。
+func Partition(vals []GetValuer, pred func(Any) bool) (match, rest []GetValuer) {
+	for _, val := range vals {
+		if pred(val.GetValue()) {
+			match = append(match, val)
+		} else {
+			rest = append(rest, val)
+		}
+	}
+	return match, rest
+}
+
+// GetValue() の値を、 key で作ったキーの map に入れる。
+// キーが重なった場合は、後のものが残る。
+func ToMap(vals []GetValuer, key func(Any) string) map[string]Any {
+	m := make(map[string]Any, len(vals))
+	for _, val := range vals {
+		v := val.GetValue()
+		m[key(v)] = v
+	}
+	return m
+}
+
+// GetValue() の値を、型名ごとに分ける
+func GroupByType(vals []GetValuer) map[string][]Any {
+	groups := map[string][]Any{}
+	for _, val := range vals {
+		v := val.GetValue()
+		name := "<nil>"
+		if v != nil {
+			name = reflect.TypeOf(v).String()
+		}
+		groups[name] = append(groups[name], v)
+	}
+	return groups
+}
+
+// キーと値の組
+// GetValuer としては Value を返す。
+type Pair struct {
+	Key, Value Any
+}
+
+func (p *Pair) GetValue() Any {
+	return p.Value
+}
 
-// ジェネリクス的な
-type GetValuer interface {
-	GetValue() Any
+// keys と values を順に組にする。長さが違えばエラーを返す。
+func Zip(keys, values []Any) ([]GetValuer, error) {
+	if len(keys) != len(values) {
+		return nil, fmt.Errorf("Zip: length mismatch: %d keys, %d values", len(keys), len(values))
+	}
+	pairs := make([]GetValuer, len(keys))
+	for i := range keys {
+		pairs[i] = &Pair{keys[i], values[i]}
+	}
+	return pairs, nil
 }
 
-// Any 型で実装
-type Value struct {
-	v Any
+// GetValue() の値を順に fn で畳み込む。
+// vals が空なら init をそのまま返す。
+func Reduce[T any](vals []GetValuer, init T, fn func(T, Any) T) T {
+	acc := init
+	for _, val := range vals {
+		acc = fn(acc, val.GetValue())
+	}
+	return acc
 }
 
-// GetValuer を実装
-func (v *Value) GetValue() Any {
-	return v.v
+// GetValue() の値が T であるものだけを取り出す
+func FilterByType[T any](vals []GetValuer) []T {
+	var out []T
+	for _, val := range vals {
+		if v, ok := val.GetValue().(T); ok {
+			out = append(out, v)
+		}
+	}
+	return out
 }
 
 func main8() {
 	// インタフェースで受け取る
-	var i GetValuer = &Value{10}
-	var s GetValuer = &Value{"vvv"}
+	var i GetValuer = NewValue(10)
+	var s GetValuer = NewValue("vvv")
 
 	// インタフェース型のコレクションに格納
 	var values []GetValuer = []GetValuer{i, s}
@@ -283,6 +766,85 @@ func main8() {
 	for _, val := range values {
 		fmt.Println(val.GetValue())
 	}
+
+	// TypedValue は Get() の戻り値がそのまま int, string になる
+	var ti TypedValue[int] = TypedValue[int]{10}
+	var ts TypedValue[string] = TypedValue[string]{"vvv"}
+	fmt.Println(ti.Get()+1, ts.Get()+"v") // 11 vvvv
+
+	// *Value は GetSetValuer も満たす
+	var gs GetSetValuer = NewValue(10)
+	gs.SetValue("changed")
+	fmt.Println(gs.GetValue()) // changed
+
+	// GetValue() は Any だが、中の型名は取れる
+	fmt.Println(NewValue(10).TypeName(), NewValue(Point{2, 3}).TypeName(), NewValue(nil).TypeName()) // int main.Point <nil>
+
+	// Values を使えば []GetValuer{NewValue(10), NewValue("vvv")} と同じものが作れる
+	for _, val := range Values(10, "vvv") {
+		fmt.Println(val.GetValue())
+	}
+
+	// 型で絞り込む
+	mixed := Values(1, "a", 2)
+	fmt.Println(FilterByType[int](mixed)) // [1 2]
+
+	// 畳み込み
+	sum := Reduce(mixed, 0, func(acc int, v Any) int {
+		if i, ok := v.(int); ok {
+			return acc + i
+		}
+		return acc
+	})
+	joined := Reduce(Values("a", "b", "c"), "", func(acc string, v Any) string {
+		if acc == "" {
+			return fmt.Sprint(v)
+		}
+		return acc + "," + fmt.Sprint(v)
+	})
+	fmt.Println(sum, joined) // 3 a,b,c
+
+	// 入れた順番を保つ
+	var ov OrderedValues
+	ov.Set("b", 1)
+	ov.Set("a", "x")
+	ov.Set("b", 2)
+	v, _ := ov.Get("b")
+	fmt.Println(ov.Keys(), v) // [b a] 2
+
+	// 最初に取り出した値を覚えているので、元の値を変えても結果は変わらない
+	orig := NewValue(1)
+	memo := Memoize(orig)
+	memo.GetValue()
+	orig.SetValue(2)
+	fmt.Println(memo.GetValue(), orig.GetValue()) // 1 2
+
+	// キーと値を組にする
+	pairs, _ := Zip([]Any{"a", "b"}, []Any{1, 2})
+	for _, p := range pairs {
+		fmt.Println(p.(*Pair).Key, p.GetValue())
+	}
+	// a 1
+	// b 2
+	_, err := Zip([]Any{"a"}, []Any{1, 2})
+	fmt.Println(err) // Zip: length mismatch: 1 keys, 2 values
+
+	// Any のスライスから探す
+	haystack := []Any{1, "a", Point{2, 3}}
+	fmt.Println(IndexOfAny(haystack, Point{2, 3}), ContainsAny(haystack, "b")) // 2 false
+
+	fmt.Println(GroupByType(mixed))                                        // map[int:[1 2] string:[a]]
+	fmt.Println(ToMap(mixed, func(v Any) string { return fmt.Sprint(v) })) // map[1:1 2:2 a:a]
+
+	numbers, others := Partition(Values(1, "a", 2.5, "b", 3), func(v Any) bool {
+		switch v.(type) {
+		case int, float64:
+			return true
+		}
+		return false
+	})
+	fmt.Println(Reduce(numbers, "", func(acc string, v Any) string { return acc + fmt.Sprint(v) + " " })) // 1 2.5 3
+	fmt.Println(Reduce(others, "", func(acc string, v Any) string { return acc + fmt.Sprint(v) + " " }))  // a b
 }
 
 ////////////////////////////
@@ -298,6 +860,35 @@ func main8() {
 	参考 http://golang.org/doc/faq#convert_slice_of_interface
 */
 func PrintAll(vals []interface{}) {
+	PrintAllTo(os.Stdout, vals)
+}
+
+// 出力先を io.Writer で受け取る版
+func PrintAllTo(w io.Writer, vals []interface{}) {
+	for _, val := range vals {
+		fmt.Fprintln(w, val)
+	}
+}
+
+// []fromElem を []toElem に代入できるかを返す。
+// 要素の型が同じでない限り false になる。
+// string が interface{} を満たしていても、 []string は []interface{} にならない。
+func CanConvertSlice(fromElem, toElem reflect.Type) bool {
+	return reflect.SliceOf(fromElem).AssignableTo(reflect.SliceOf(toElem))
+}
+
+// ジェネリクスを使えば、上の変換は一度書けば済む。
+// []T を []interface{} に詰め替えて返す。
+func ToAny[T any](in []T) []interface{} {
+	out := make([]interface{}, len(in))
+	for i, v := range in {
+		out[i] = v
+	}
+	return out
+}
+
+// そもそも型パラメータで受け取れば、変換自体が要らない。
+func PrintAllT[T any](vals []T) {
 	for _, val := range vals {
 		fmt.Println(val)
 	}
@@ -315,6 +906,25 @@ func main9() {
 		vals[i] = v
 	}
 	PrintAll(vals)
+
+	// ToAny を使う場合
+	PrintAll(ToAny(names))
+	PrintAll(ToAny([]int{1, 2, 3}))
+
+	// reflect でも確かめられる
+	stringType := reflect.TypeOf("")
+	anyType := reflect.TypeOf((*interface{})(nil)).Elem()
+	fmt.Println(stringType.AssignableTo(anyType))     // true
+	fmt.Println(CanConvertSlice(stringType, anyType)) // false
+	fmt.Println(CanConvertSlice(anyType, anyType))    // true
+
+	// PrintAllT なら []string をそのまま渡せる
+	PrintAllT(names)
+
+	// io.Writer を満たすものなら何にでも書き出せる
+	var buf bytes.Buffer
+	PrintAllTo(&buf, vals)
+	fmt.Printf("%q\n", buf.String()) // "one\ntwo\nthree\n"
 }
 
 ////////////////////////////
@@ -336,6 +946,33 @@ func main9() {
 
 var JSONString = `{ "created_at": "Thu May 31 00:00:01 +0000 2012" } `
 
+// interface{} にパースすると、数値は全て float64 になる。
+// 整数で int64 の範囲に収まる float64 を int64 に変換し、
+// 範囲外のものは float64 のまま残す。
+// map と slice は再帰的にたどり、コピーせずにその場で書き換える。
+func NormalizeJSON(v interface{}) interface{} {
+	switch checked := v.(type) {
+	case float64:
+		// math.MaxInt64 は float64 では 2^63 に丸められるので、上限は < で比べる
+		if checked == math.Trunc(checked) && checked >= math.MinInt64 && checked < math.MaxInt64 {
+			return int64(checked)
+		}
+		return checked
+	case map[string]interface{}:
+		for k, e := range checked {
+			checked[k] = NormalizeJSON(e)
+		}
+		return checked
+	case []interface{}:
+		for i, e := range checked {
+			checked[i] = NormalizeJSON(e)
+		}
+		return checked
+	default:
+		return v
+	}
+}
+
 func main10() {
 	// map として、 {string: interface{}} としてしまえば
 	// value がなんであれパースは可能
@@ -349,6 +986,27 @@ func main10() {
 	for k, v := range parsedMap {
 		fmt.Println(k, reflect.TypeOf(v)) // created_at string
 	}
+
+	// 数値は float64 になるので、必要なら NormalizeJSON で整える
+	for _, s := range []string{`{"n": 3}`, `{"n": 3.5}`} {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(s), &m); err != nil {
+			panic(err)
+		}
+		NormalizeJSON(m)
+		fmt.Println(m["n"], reflect.TypeOf(m["n"]))
+	}
+	// 3 int64
+	// 3.5 float64
+
+	// json.Marshal は map のキーをどの階層でもソートして出力するので、
+	// NormalizeJSON した入れ子の map でも、入れた順番によらず同じ JSON になる。
+	// キーの順番を揃えるための専用の関数は要らない。
+	m1 := map[string]interface{}{"b": 1, "a": map[string]interface{}{"y": 2, "x": 3}}
+	m2 := map[string]interface{}{"a": map[string]interface{}{"x": 3, "y": 2}, "b": 1}
+	b1, _ := json.Marshal(m1)
+	b2, _ := json.Marshal(m2)
+	fmt.Println(string(b1), bytes.Equal(b1, b2)) // {"a":{"x":3,"y":2},"b":1} true
 }
 
 ////////////////////////////
@@ -372,9 +1030,33 @@ func main10() {
 
 type Timestamp time.Time
 
+// UnmarshalJSON が順に試すレイアウト。
+// init などで append すれば独自のフォーマットも受け付けられる。
+var TimestampLayouts = []string{time.RubyDate, time.RFC3339, time.RFC1123Z, rubyDateNoZone}
+
+// +0000 が抜けた RubyDate
+// タイムゾーンが無いと time.Parse は UTC として扱う。
+const rubyDateNoZone = "Mon Jan _2 15:04:05 2006"
+
 // Unmarshaller を実装
+// null や "" はゼロ値のままにする。
+// (凍結されたアカウントなどで created_at が null になることがある)
 func (t *Timestamp) UnmarshalJSON(b []byte) error {
-	v, err := time.Parse(time.RubyDate, string(b[1:len(b)-1]))
+	if string(b) == "null" {
+		return nil
+	}
+
+	// 文字列以外(数値など)はここでエラーになるので、
+	// b[1:len(b)-1] のように直接スライスして panic することはない。
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		return nil
+	}
+
+	v, err := parseTimestamp(s)
 	if err != nil {
 		return err
 	}
@@ -382,6 +1064,62 @@ func (t *Timestamp) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// TimestampLayouts を順に試し、最初にパースできたものを返す。
+// 全て失敗したらそれぞれのエラーをまとめて返す。
+func parseTimestamp(s string) (time.Time, error) {
+	var errs []error
+	for _, layout := range TimestampLayouts {
+		v, err := time.Parse(layout, s)
+		if err == nil {
+			return v, nil
+		}
+		errs = append(errs, err)
+	}
+	return time.Time{}, errors.Join(errs...)
+}
+
+// map などを経由せずに、一つの値を time.Time にする。
+// "..." で囲まれた JSON の文字列でも、囲まれていない文字列でもよい。
+func ParseTimestamp(b []byte) (time.Time, error) {
+	s := string(b)
+	if len(b) >= 2 && b[0] == '"' && b[len(b)-1] == '"' {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return parseTimestamp(s)
+}
+
+// Marshaler を実装
+// UnmarshalJSON と同じ time.RubyDate で書き出すので、
+// パースしたものをそのまま JSON に戻せる。
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + time.Time(t).Format(time.RubyDate) + `"`), nil
+}
+
+// fmt.Stringer を実装
+// time.Time に変換しないと、 fmt は struct の中身をそのまま出力してしまう。
+func (t Timestamp) String() string {
+	return time.Time(t).Format(time.RubyDate)
+}
+
+// time.Time の In に委譲する。
+// 同じ時刻のまま、 loc のタイムゾーンで表したものを返す。
+func (t Timestamp) In(loc *time.Location) Timestamp {
+	return Timestamp(time.Time(t).In(loc))
+}
+
+// time.Time の Equal に委譲する。
+// == だと Location の違いまで比較されてしまう。
+func (t Timestamp) Equal(o Timestamp) bool {
+	return time.Time(t).Equal(time.Time(o))
+}
+
+// map を使わずに struct のフィールドとしても使える
+type Tweet struct {
+	CreatedAt Timestamp `json:"created_at"`
+}
+
 func main11() {
 	var val map[string]Timestamp // 定義した型を使う
 
@@ -394,6 +1132,61 @@ func main11() {
 		fmt.Println(k, time.Time(v), reflect.TypeOf(v))
 		// created_at 2012-05-31 00:00:01 +0000 +0000 main.Timestamp
 	}
+
+	// MarshalJSON も実装しているので、元の文字列に戻せる
+	b, err := json.Marshal(val)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(b)) // {"created_at":"Thu May 31 00:00:01 +0000 2012"}
+
+	// null や "" はゼロ値、文字列でないものはエラー
+	for _, s := range []string{`null`, `""`, `12345`} {
+		var ts Timestamp
+		err := json.Unmarshal([]byte(s), &ts)
+		fmt.Println(s, time.Time(ts).IsZero(), err)
+	}
+	// null true <nil>
+	// "" true <nil>
+	// 12345 true json: cannot unmarshal number into Go value of type string
+
+	// TimestampLayouts のどれかに合えばパースできる
+	for _, s := range []string{
+		`{"created_at": "Thu May 31 00:00:01 +0000 2012"}`,
+		`{"created_at": "2012-05-31T00:00:01Z"}`,
+		`{"created_at": "Thu, 31 May 2012 00:00:01 +0000"}`,
+	} {
+		var m map[string]Timestamp
+		if err := json.Unmarshal([]byte(s), &m); err != nil {
+			panic(err)
+		}
+		fmt.Println(time.Time(m["created_at"]).UTC()) // 2012-05-31 00:00:01 +0000 UTC
+	}
+
+	// 同じ文字列からパースしたものは Equal で、 String() も一致する
+	var t1, t2 Timestamp
+	json.Unmarshal([]byte(`"Thu May 31 00:00:01 +0000 2012"`), &t1)
+	json.Unmarshal([]byte(`"Thu May 31 00:00:01 +0000 2012"`), &t2)
+	fmt.Println(t1.Equal(t2), t1) // true Thu May 31 00:00:01 +0000 2012
+
+	// 日本時間で表示する
+	// LoadLocation は tzdata が無い環境で失敗するので、固定の +9 時間で作る
+	jst := time.FixedZone("JST", 9*60*60)
+	fmt.Println(t1.In(jst), t1.In(jst).Equal(t1)) // Thu May 31 09:00:01 +0900 2012 true
+
+	// 値一つだけなら ParseTimestamp
+	fmt.Println(ParseTimestamp([]byte(`"Thu May 31 00:00:01 +0000 2012"`))) // 2012-05-31 00:00:01 +0000 UTC <nil>
+	fmt.Println(ParseTimestamp([]byte(`Thu May 31 00:00:01 +0000 2012`)))   // 2012-05-31 00:00:01 +0000 UTC <nil>
+	fmt.Println(ParseTimestamp([]byte(`Thu May 31 00:00:01 2012`)))         // 2012-05-31 00:00:01 +0000 UTC <nil>
+	_, err = ParseTimestamp([]byte(`May 31`))
+	fmt.Println(err != nil) // true
+
+	// struct に直接デコードする
+	var tweet Tweet
+	if err := json.Unmarshal([]byte(JSONString), &tweet); err != nil {
+		panic(err)
+	}
+	fmt.Println(time.Time(tweet.CreatedAt).UTC()) // 2012-05-31 00:00:01 +0000 UTC
 }
 
 ////////////////////////////
@@ -419,22 +1212,109 @@ func main11() {
 */
 
 // 各型が、自身のパース実装を持てばよいので、そのメソッドだけ定義しておく。
+// メソッド名を json.Unmarshaler と揃えておけば、
+// Entity を実装した型はそのまま json.Unmarshal にも渡せる。
 type Entity interface {
-	UnmarshallJSON([]byte) error
+	UnmarshalJSON([]byte) error
 }
 
 func GetEntity(b []byte, e Entity) error {
 	// 各実装に処理を移譲
-	return e.UnmarshallJSON(b)
+	// 複数の Entity を試したときにどれが失敗したかわかるよう、型名を付けて返す。
+	if err := e.UnmarshalJSON(b); err != nil {
+		return &DecodeError{entityTypeName(e), err}
+	}
+	return afterDecode(e)
+}
+
+// デコードに成功した後の共通処理。
+// Validator も実装していれば検証し、通れば OnDecode を呼ぶ。
+// GetEntityStrict など、デコードの仕方が違うものもここを通す。
+func afterDecode(e Entity) error {
+	if v, ok := e.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return &DecodeError{entityTypeName(e), err}
+		}
+	}
+
+	if OnDecode != nil {
+		fields := 0
+		if v := reflect.Indirect(reflect.ValueOf(e)); v.Kind() == reflect.Struct {
+			fields = v.NumField()
+		}
+		OnDecode(entityTypeName(e), fields)
+	}
+	return nil
+}
+
+// GetEntity (と GetEntityStrict) がデコードに成功するたびに、型名とフィールド数を渡して呼ばれる。
+// ログなどを仕込みたいときに設定する。
+var OnDecode func(typeName string, fields int)
+
+// GetEntity に失敗したら panic する。
+// 失敗するとすればプログラムの誤りである、テストや初期化時の固定の JSON に使う。
+// 外から受け取った JSON には使わないこと。
+func MustGetEntity(b []byte, e Entity) Entity {
+	if err := GetEntity(b, e); err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// GetEntity が返すエラー
+// errors.As で取り出せば、どの型で失敗したかがわかる。
+type DecodeError struct {
+	Type string // 失敗した Entity の型名
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return "GetEntity: " + e.Type + ": " + e.Err.Error()
+}
+
+// errors.Is や errors.As で元のエラーもたどれるようにする
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// *UserData なら UserData のように、ポインタを外した型名を返す
+func entityTypeName(e interface{}) string {
+	t := reflect.TypeOf(e)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// GetEntity の逆向き。
+// json.Marshaler と同じシグネチャにしておく。
+type MarshalEntity interface {
+	MarshalJSON() ([]byte, error)
+}
+
+func PutEntity(e MarshalEntity) ([]byte, error) {
+	// 各実装に処理を移譲
+	b, err := e.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("PutEntity: %s: %w", reflect.TypeOf(e), err)
+	}
+	return b, nil
+}
+
+// デコードした結果を自分で検証したい Entity が実装する。
+// Entity には含めず、必要な型だけが実装すればよい。
+type Validator interface {
+	Validate() error
 }
 
 // 型を定義
 // User に関する必要なデータだけ取りたい型的な
+// タグで JSON のキー名を明示しておく
 type UserData struct {
-	Id        int
-	Name      string
-	Time_Zone string
-	Lang      string
+	Id       int    `json:"id"`
+	Name     string `json:"name"`
+	TimeZone string `json:"time_zone"`
+	Lang     string `json:"lang"`
 }
 
 // *_count だけ適当に取りたい型的な
@@ -450,22 +1330,85 @@ type CountData struct {
 // ここでは、 json モジュールになげるだけで
 // 同じ実装でできてしまったが、
 // 本来 Entity ごとに違う実装になる。
-func (d *UserData) UnmarshallJSON(b []byte) error {
-	err := json.Unmarshal(b, d)
+//
+// d をそのまま json.Unmarshal に渡すと UnmarshalJSON が
+// 再帰的に呼ばれてしまうので、メソッドを持たない別の型に変換して渡す。
+//
+// "id": null のような null は、 json.Unmarshal がエラーにせず
+// 何もしないので、そのフィールドはゼロ値のままになる。
+func (d *UserData) UnmarshalJSON(b []byte) error {
+	type userData UserData
+	err := json.Unmarshal(b, (*userData)(d))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (d *CountData) UnmarshallJSON(b []byte) error {
-	err := json.Unmarshal(b, d)
+func (d *CountData) UnmarshalJSON(b []byte) error {
+	type countData CountData
+	err := json.Unmarshal(b, (*countData)(d))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// MarshalEntity を実装
+// UnmarshalJSON と同じく、再帰しないよう別の型に変換して渡す。
+func (d UserData) MarshalJSON() ([]byte, error) {
+	type userData UserData
+	return json.Marshal(userData(d))
+}
+
+// Validator を実装
+func (d *UserData) Validate() error {
+	if d.Id == 0 {
+		return errors.New("id is required")
+	}
+	if d.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+// 全ての count の合計
+func (d CountData) Total() int {
+	return d.Followers_count + d.Friends_count + d.Listed_count +
+		d.Favourites_count + d.Statuses_count
+}
+
+// フィールドごとに足し合わせた CountData を返す
+func (d CountData) Merge(o CountData) CountData {
+	return CountData{
+		Followers_count:  d.Followers_count + o.Followers_count,
+		Friends_count:    d.Friends_count + o.Friends_count,
+		Listed_count:     d.Listed_count + o.Listed_count,
+		Favourites_count: d.Favourites_count + o.Favourites_count,
+		Statuses_count:   d.Statuses_count + o.Statuses_count,
+	}
+}
+
+// 全ての CountData を足し合わせる。無ければゼロ値を返す。
+func SumCounts(ds ...CountData) CountData {
+	var sum CountData
+	for _, d := range ds {
+		sum = sum.Merge(d)
+	}
+	return sum
+}
+
+// sort.Interface を実装し、 Total() の大きい順に並べる
+type CountDataSlice []CountData
+
+func (s CountDataSlice) Len() int           { return len(s) }
+func (s CountDataSlice) Less(i, j int) bool { return s[i].Total() > s[j].Total() }
+func (s CountDataSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// json.Unmarshaler を満たしていることをコンパイル時に確認
+var _ json.Unmarshaler = (*UserData)(nil)
+var _ json.Unmarshaler = (*CountData)(nil)
+
 func main12() {
 	// 対象の JSON 文字列
 	EntityString := `{
@@ -485,21 +1428,108 @@ func main12() {
 	GetEntity([]byte(EntityString), countData)
 	fmt.Println(*userData)  // {51442629 Jxck Tokyo ja}
 	fmt.Println(*countData) // {1620 617 204 2895 17387}
-}
 
-// タグ付きの Struct を定義
-type TaggedStruct struct {
-	field string `tag:"tag1"`
-}
+	// 失敗すると、どの型で失敗したかがエラーに含まれる
+	err := GetEntity([]byte(`{"id":`), &UserData{})
+	fmt.Println(err) // GetEntity: UserData: unexpected end of JSON input
 
-func main13() {
-	// reflect でタグを取得
-	var ts = TaggedStruct{}
-	var t reflect.Type = reflect.TypeOf(ts)
-	var f reflect.StructField = t.Field(0)
-	var tag reflect.StructTag = f.Tag
-	var val string = tag.Get("json")
-	fmt.Println(tag, val) // json:"emp_name" emp_name
+	// json.Unmarshaler でもあるので、 json.Unmarshal に直接渡せる
+	var u UserData
+	if err := json.Unmarshal([]byte(EntityString), &u); err != nil {
+		panic(err)
+	}
+	fmt.Println(u)          // {51442629 Jxck Tokyo ja}
+	fmt.Println(u.TimeZone) // Tokyo
+
+	// null はゼロ値として扱われる
+	var nullId UserData
+	err = json.Unmarshal([]byte(`{"id": null, "name": "x"}`), &nullId)
+	fmt.Println(nullId.Id, err) // 0 <nil>
+
+	// UserData は Validator なので、 GetEntity で検証される
+	err = GetEntity([]byte(`{"id": 0, "name": "Jxck"}`), &UserData{})
+	fmt.Println(err) // GetEntity: UserData: id is required
+
+	// デコードのたびに呼ばれる
+	OnDecode = func(typeName string, fields int) {
+		fmt.Println("decoded", typeName, fields) // decoded UserData 4
+	}
+	GetEntity([]byte(EntityString), &UserData{})
+	OnDecode = nil
+
+	// errors.As で DecodeError を取り出す
+	var de *DecodeError
+	err = GetEntity([]byte(`{"followers_count": "many"}`), &CountData{})
+	if errors.As(err, &de) {
+		fmt.Println(de.Type) // CountData
+	}
+
+	// デコードしたものをエンコードし直す
+	b, err := PutEntity(userData)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(b)) // {"id":51442629,"name":"Jxck","time_zone":"Tokyo","lang":"ja"}
+
+	fmt.Println(countData.Total()) // 22723
+
+	// sort.Sort に渡せる
+	counts := CountDataSlice{{Followers_count: 1}, *countData, {Followers_count: 100}}
+	sort.Sort(counts)
+	for _, c := range counts {
+		fmt.Println(c.Total())
+	}
+	// 22723
+	// 100
+	// 1
+
+	// シャードごとの集計を足し合わせる
+	fmt.Println(CountData{Followers_count: 1}.Merge(CountData{Followers_count: 2, Listed_count: 3})) // {3 0 3 0 0}
+	fmt.Println(SumCounts(*countData, CountData{}, CountData{Statuses_count: 13}))                   // {1620 617 204 2895 17400}
+}
+
+// タグ付きの Struct を定義
+type TaggedStruct struct {
+	field string `tag:"tag1"`
+}
+
+// 最初のフィールドのタグから key の値を取り出す。
+// struct 以外やフィールドの無い struct なら空文字を返す。
+func firstFieldTag(v interface{}, key string) string {
+	// reflect でタグを取得
+	var t reflect.Type = reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Struct || t.NumField() == 0 {
+		return ""
+	}
+	var f reflect.StructField = t.Field(0)
+	var tag reflect.StructTag = f.Tag
+	return tag.Get(key)
+}
+
+// フィールド名を指定してタグの値を取り出す。
+// タグは reflect.Type から読むだけで値には触れないので、
+// 非公開フィールドでも panic しない。
+// フィールドやタグが無ければ ok は false になる。
+func FieldTagValue(v interface{}, fieldName, tagKey string) (string, bool) {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Struct {
+		return "", false
+	}
+	f, ok := t.FieldByName(fieldName)
+	if !ok {
+		return "", false
+	}
+	return f.Tag.Lookup(tagKey)
+}
+
+func main13() {
+	var ts = TaggedStruct{}
+	fmt.Println(firstFieldTag(ts, "tag"))  // tag1
+	fmt.Println(firstFieldTag(ts, "json")) // 無いキーは空文字
+
+	fmt.Println(FieldTagValue(ts, "field", "tag"))         // tag1 true
+	fmt.Println(FieldTagValue(Employee{}, "Name", "json")) // emp_name true
+	fmt.Println(FieldTagValue(Employee{}, "Age", "json"))  //  false
 }
 
 // JSON をマッピングするために
@@ -510,6 +1540,206 @@ type Employee struct {
 	Dept  string `json:"dept"`
 }
 
+// main13 の処理を全フィールドに広げたもの。
+// フィールド名とタグの値の map を返す。
+// 非公開フィールドは飛ばし、 struct 以外なら空の map を返す。
+func StructTags(v interface{}, key string) map[string]string {
+	tags := map[string]string{}
+
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return tags
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tags[f.Name] = f.Tag.Get(key)
+	}
+	return tags
+}
+
+// JSON にしたときのフィールド名を順に返す。
+// タグがあればタグの名前、無ければフィールド名を使い、 "-" は飛ばす。
+// タグの無い埋め込み struct は、 encoding/json と同じく中のフィールドを展開する。
+// ポインタで埋め込んだ struct も同じ。
+func JSONFields(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	return jsonFieldsOf(t)
+}
+
+func jsonFieldsOf(t reflect.Type) []string {
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			fields = append(fields, jsonFieldsOf(ft)...)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+// ゼロ値のままのフィールドを、 json の名前で返す。
+// デコード後に呼べば、 JSON に無かった(かゼロ値だった)フィールドがわかる。
+func ZeroFields(v interface{}) []string {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var zeros []string
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if rv.Field(i).IsZero() {
+			zeros = append(zeros, name)
+		}
+	}
+	return zeros
+}
+
+// 公開フィールドを "名前: 値" の行にする。
+// 名前は json タグがあればそれを使い、値の位置は揃える。
+func StructString(v interface{}) string {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return fmt.Sprint(v)
+	}
+
+	var names []string
+	var values []interface{}
+	width := 0
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if len(name) > width {
+			width = len(name)
+		}
+		names = append(names, name)
+		values = append(values, rv.Field(i).Interface())
+	}
+
+	var buf bytes.Buffer
+	for i, name := range names {
+		fmt.Fprintf(&buf, "%-*s %v\n", width+1, name+":", values[i])
+	}
+	return buf.String()
+}
+
+// m のキーのうち v の json タグにあるものを、 Go のフィールド名に置き換えた map を返す。
+// タグに無いキーはそのまま残し、 m 自体は変更しない。
+func ApplyTagMapping(v interface{}, m map[string]interface{}) map[string]interface{} {
+	fieldByTag := map[string]string{}
+	for field, tag := range StructTags(v, "json") {
+		name := strings.Split(tag, ",")[0]
+		if name != "" && name != "-" {
+			fieldByTag[name] = field
+		}
+	}
+
+	out := make(map[string]interface{}, len(m))
+	for k, val := range m {
+		if field, ok := fieldByTag[k]; ok {
+			k = field
+		}
+		out[k] = val
+	}
+	return out
+}
+
+// a と b をそれぞれ JSON にして、値の違うキーを {a の値, b の値} で返す。
+// 片方にしか無いキーは、無い側が nil になる。
+func JSONDiff(a, b interface{}) (map[string][2]interface{}, error) {
+	am, err := toJSONMap(a)
+	if err != nil {
+		return nil, err
+	}
+	bm, err := toJSONMap(b)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := map[string][2]interface{}{}
+	for k, av := range am {
+		if bv := bm[k]; !reflect.DeepEqual(av, bv) {
+			diff[k] = [2]interface{}{av, bv}
+		}
+	}
+	for k, bv := range bm {
+		if _, ok := am[k]; !ok {
+			diff[k] = [2]interface{}{nil, bv}
+		}
+	}
+	return diff, nil
+}
+
+func toJSONMap(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	err = json.Unmarshal(b, &m)
+	return m, err
+}
+
+// json タグの名前が、フィールド名と(大文字小文字を無視して)違うものを返す。
+// タグが無い、または "-" のフィールドは対象外。
+func TagMismatches(v interface{}) map[string]string {
+	mismatches := map[string]string{}
+	for field, tag := range StructTags(v, "json") {
+		name := strings.Split(tag, ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		if !strings.EqualFold(field, name) {
+			mismatches[field] = name
+		}
+	}
+	return mismatches
+}
+
 func main14() {
 	// フィールド名が Struct の Filed 名と違う JSON も
 	// json:"fieldname" の形でタグを付けてあるので
@@ -527,6 +1757,942 @@ func main14() {
 		fmt.Println("error:", err)
 	}
 	fmt.Printf("%+v\n", john) // {Name:john Email:john@golang.com Dept:HR}
+
+	// タグをまとめて取り出す
+	fmt.Println(StructTags(john, "json")) // map[Dept:dept Email:emp_email Name:emp_name]
+	fmt.Println(TagMismatches(john))      // map[Email:emp_email Name:emp_name]
+	fmt.Println(JSONFields(john))         // [emp_name emp_email dept]
+	fmt.Println(JSONFields(Page{}))       // [Page] Document の text は非公開
+
+	renamed := ApplyTagMapping(Employee{}, map[string]interface{}{"emp_name": "john"})
+	fmt.Println(renamed) // map[Name:john]
+
+	moved := john
+	moved.Dept = "Dev"
+	diff, _ := JSONDiff(john, moved)
+	fmt.Println(diff) // map[dept:[HR Dev]]
+
+	var partial UserData
+	json.Unmarshal([]byte(`{"name": "x"}`), &partial)
+	fmt.Println(ZeroFields(partial)) // [id time_zone lang]
+
+	fmt.Print(StructString(john))
+	// emp_name:  john
+	// emp_email: john@golang.com
+	// dept:      HR
+}
+
+////////////////////////////
+
+/*
+	JSON の "type" フィールドで Entity を振り分ける。
+
+	{"type": "user", ...} なら UserData、
+	{"type": "count", ...} なら CountData というように、
+	名前と Entity を生成する関数を登録しておき、
+	デコード時に引いてくる。
+*/
+
+var entityFactories = map[string]func() Entity{}
+
+// name に対応する Entity の生成関数を登録する。
+func RegisterEntity(name string, factory func() Entity) {
+	entityFactories[name] = factory
+}
+
+// "type" フィールドを見て Entity を生成し、デコードして返す。
+func DecodeEntity(b []byte) (Entity, error) {
+	var t struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, err
+	}
+
+	factory, ok := entityFactories[t.Type]
+	if !ok {
+		return nil, fmt.Errorf("DecodeEntity: unknown entity type %q", t.Type)
+	}
+
+	// GetEntity を通して、検証や OnDecode も同じように行う
+	e := factory()
+	if err := GetEntity(b, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func main15() {
+	RegisterEntity("user", func() Entity { return &UserData{} })
+	RegisterEntity("count", func() Entity { return &CountData{} })
+
+	stream := []string{
+		`{"type": "user", "id": 1, "name": "Jxck"}`,
+		`{"type": "count", "followers_count": 1620}`,
+		`{"type": "tweet"}`,
+	}
+	for _, s := range stream {
+		e, err := DecodeEntity([]byte(s))
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Printf("%T %v\n", e, e)
+	}
+	// *main.UserData &{1 Jxck  }
+	// *main.CountData &{1620 0 0 0 0}
+	// DecodeEntity: unknown entity type "tweet"
+}
+
+////////////////////////////
+
+/*
+	GetEntity は []byte を受け取るので、
+	HTTP のボディなどは一度全部読み込む必要がある。
+	io.Reader から直接デコードできるようにする。
+*/
+
+// r から JSON の値を一つ読み、 GetEntity に渡す。
+// json.Decoder は値一つ分しか読まないので、ボディ全体を先に読む必要はない。
+func DecodeEntityFrom(r io.Reader, e Entity) error {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return fmt.Errorf("DecodeEntityFrom: %s: %w", reflect.TypeOf(e), err)
+	}
+	return GetEntity(raw, e)
+}
+
+// 長いボディを読む途中でもキャンセルできるよう、
+// 少しずつ読みながら ctx を確認する。
+func GetEntityCtx(ctx context.Context, r io.Reader, e Entity) error {
+	var buf bytes.Buffer
+	chunk := make([]byte, 4096)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := r.Read(chunk)
+		buf.Write(chunk[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("GetEntityCtx: %w", err)
+		}
+	}
+	return GetEntity(buf.Bytes(), e)
+}
+
+func main16() {
+	u := &UserData{}
+	r := strings.NewReader(`{"id": 1, "name": "Jxck", "lang": "ja"}`)
+	if err := DecodeEntityFrom(r, u); err != nil {
+		panic(err)
+	}
+	fmt.Println(*u) // {1 Jxck  ja}
+
+	// キャンセルされていれば読み込みを止める
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := GetEntityCtx(ctx, strings.NewReader(`{"id": 1}`), &UserData{})
+	fmt.Println(errors.Is(err, context.Canceled)) // true
+}
+
+////////////////////////////
+
+/*
+	冒頭で考えた GetEntity(*http.Request) を、
+	Entity を使って実際に書いてみる。
+*/
+
+func EntityFromRequest(r *http.Request, e Entity) error {
+	defer r.Body.Close()
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("EntityFromRequest: %w", err)
+	}
+	return GetEntity(b, e)
+}
+
+func main17() {
+	body := strings.NewReader(`{"id": 51442629, "name": "Jxck", "time_zone": "Tokyo", "lang": "ja"}`)
+	req, err := http.NewRequest("POST", "/users", body)
+	if err != nil {
+		panic(err)
+	}
+
+	u := &UserData{}
+	if err := EntityFromRequest(req, u); err != nil {
+		panic(err)
+	}
+	fmt.Println(*u) // {51442629 Jxck Tokyo ja}
+}
+
+////////////////////////////
+
+/*
+	interface の値は、メソッドテーブルと値の二つのポインタから成る。
+	メソッドテーブルの中身は reflect で覗くことができる。
+*/
+
+// v の動的な型が持つメソッド名を、アルファベット順で返す。
+func MethodNames(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil
+	}
+	return methodNamesOf(t)
+}
+
+// interface の値が持つ、型と値の両方を文字列にする。
+// 型も値も持たない nil は <nil> になる。
+func Dump(v interface{}) string {
+	if v == nil {
+		return "<nil>"
+	}
+	t := reflect.TypeOf(v)
+	return fmt.Sprintf("%s{%v} (%s)", t, v, t)
+}
+
+// 値の型 T と、ポインタの型 *T のメソッドセットをそれぞれ返す。
+// ポインタレシーバのメソッドは *T にしか含まれないので、
+// Document{} ではなく &Document{} でないと Accessor にならない理由がわかる。
+func MethodSetKinds(v interface{}) (valueMethods, pointerMethods []string) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil, nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return methodNamesOf(t), methodNamesOf(reflect.PointerTo(t))
+}
+
+func methodNamesOf(t reflect.Type) []string {
+	names := make([]string, t.NumMethod())
+	for i := range names {
+		names[i] = t.Method(i).Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// interface は型と値の組なので、 nil ポインタを入れた interface は
+// 型を持っているため == nil にならない。
+// 中身の値が nil の場合も true を返す。
+func IsNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// インタフェースの reflect.Type は、 nil ポインタから Elem() で取り出す。
+var GetterType = reflect.TypeOf((*Getter)(nil)).Elem()
+var accessorType = reflect.TypeOf((*Accessor)(nil)).Elem()
+
+// v が ifaceType のインタフェースを実装しているかを実行時に調べる。
+// 型アサーションと違い、調べるインタフェースを値として渡せる。
+func Implements(v interface{}, ifaceType reflect.Type) bool {
+	t := reflect.TypeOf(v)
+	if t == nil || ifaceType == nil || ifaceType.Kind() != reflect.Interface {
+		return false
+	}
+	return t.Implements(ifaceType)
+}
+
+// ifaceType のメソッドのうち、 v の型が持っていないものを返す。
+// Implements が false になる理由を調べるのに使う。
+func MissingMethods(v interface{}, ifaceType reflect.Type) []string {
+	missing := []string{}
+	if ifaceType == nil || ifaceType.Kind() != reflect.Interface {
+		return missing
+	}
+	t := reflect.TypeOf(v)
+	for i := 0; i < ifaceType.NumMethod(); i++ {
+		name := ifaceType.Method(i).Name
+		if t == nil {
+			missing = append(missing, name)
+			continue
+		}
+		m, ok := t.MethodByName(name)
+		// 名前が同じでも、シグネチャが違えば実装していないことになる
+		if !ok || !sameSignature(m.Type, ifaceType.Method(i).Type) {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// 型のメソッド(先頭の引数がレシーバ)と、インタフェースのメソッドのシグネチャを比べる
+func sameSignature(method, ifaceMethod reflect.Type) bool {
+	if method.NumIn()-1 != ifaceMethod.NumIn() || method.NumOut() != ifaceMethod.NumOut() {
+		return false
+	}
+	for i := 0; i < ifaceMethod.NumIn(); i++ {
+		if method.In(i+1) != ifaceMethod.In(i) {
+			return false
+		}
+	}
+	for i := 0; i < ifaceMethod.NumOut(); i++ {
+		if method.Out(i) != ifaceMethod.Out(i) {
+			return false
+		}
+	}
+	return method.IsVariadic() == ifaceMethod.IsVariadic()
+}
+
+// method が埋め込んだフィールドから昇格(promote)したものなら true、
+// 外側の型で定義(オーバーライド)されていれば false を返す。
+//
+// reflect にはどちらかを直接知る手段が無いが、
+// 昇格したメソッドはコンパイラが生成したラッパーになるので、
+// その定義位置が <autogenerated> になっていることで見分ける。
+// これは仕様で決まったものではなく、今のコンパイラの出力に頼った
+// ベストエフォートの判定なので、将来のバージョンでは外れることがある。
+func IsMethodPromoted(v interface{}, method string) bool {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return false
+	}
+	m, ok := t.MethodByName(method)
+	if !ok {
+		return false
+	}
+
+	st := t
+	if st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct || !embeddedHasMethod(st, method) {
+		return false
+	}
+	return isAutogenerated(m)
+}
+
+// 外側の型で定義し直して、埋め込んだフィールドのメソッドを隠しているものを返す。
+func OverriddenMethods(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	overridden := []string{}
+	pt := reflect.PointerTo(t)
+	for i := 0; i < pt.NumMethod(); i++ {
+		m := pt.Method(i)
+		if embeddedHasMethod(t, m.Name) && !isAutogenerated(m) {
+			overridden = append(overridden, m.Name)
+		}
+	}
+	return overridden
+}
+
+// 埋め込んだフィールドのどれかが、同名のメソッドを持っているか
+// Document を埋め込んだ場合は *Document のメソッドセットで調べる。
+// *Document を埋め込んだ場合はそのまま調べる(**Document にメソッドは無い)。
+func embeddedHasMethod(st reflect.Type, method string) bool {
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if !f.Anonymous {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() != reflect.Ptr {
+			ft = reflect.PointerTo(ft)
+		}
+		if _, ok := ft.MethodByName(method); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// コンパイラが生成したラッパーのメソッドか
+// "<autogenerated>" という名前はドキュメントに無いコンパイラの出力なので、
+// あくまで経験則による判定になる。
+func isAutogenerated(m reflect.Method) bool {
+	pc := m.Func.Pointer()
+	file, _ := runtime.FuncForPC(pc).FileLine(pc)
+	return file == "<autogenerated>"
+}
+
+func main18() {
+	fmt.Println(MethodNames(&Document{}))     // [Clone GetText Key SetText WithText]
+	fmt.Println(MethodNames(&ExtendedPage{})) // [BaseText Clone GetText Key SetText UnmarshalJSON WithText]
+
+	// 値の Document にはポインタレシーバのメソッドは含まれない
+	fmt.Println(MethodNames(Document{})) // []
+
+	valueMethods, pointerMethods := MethodSetKinds(Document{})
+	fmt.Println(valueMethods, pointerMethods) // [] [Clone GetText Key SetText WithText]
+
+	fmt.Println(Implements(&ExtendedPage{}, GetterType)) // true
+	fmt.Println(Implements("string", GetterType))        // false
+	fmt.Println(Implements(nil, GetterType))             // false
+
+	// Accessor を満たすには何が足りないか
+	fmt.Println(MissingMethods(&Document{}, accessorType))         // []
+	fmt.Println(MissingMethods(Freeze(&Document{}), accessorType)) // [SetText]
+	fmt.Println(MissingMethods(Document{}, accessorType))          // [GetText SetText]
+
+	// Page の GetText は Document から昇格したもの、
+	// ExtendedPage の GetText はオーバーライドしたもの
+	fmt.Println(IsMethodPromoted(&Page{}, "GetText"))         // true
+	fmt.Println(IsMethodPromoted(&ExtendedPage{}, "GetText")) // false
+	fmt.Println(OverriddenMethods(&ExtendedPage{}))           // [Clone GetText WithText]
+	fmt.Println(OverriddenMethods(&Page{}))                   // [Clone WithText]
+
+	fmt.Println(Dump(Point{2, 3})) // main.Point{(2, 3)} (main.Point)
+	fmt.Println(Dump("string"))    // string{string} (string)
+	fmt.Println(Dump(nil))         // <nil>
+
+	// nil ポインタを入れた interface は nil ではない
+	var doc *Document
+	var acsr Accessor = doc
+	fmt.Println(acsr == nil, IsNil(acsr))       // false true
+	fmt.Println(IsNil(nil), IsNil(&Document{})) // true false
+}
+
+////////////////////////////
+
+/*
+	Twitter のレスポンスはユーザの配列になっていることが多い。
+	配列の要素ごとに Entity を作ってデコードする。
+*/
+
+// トップレベルの JSON 配列を、要素ごとに factory で作った Entity にデコードする。
+// 途中で失敗した場合は、そこまでの結果と、何番目で失敗したかを含むエラーを返す。
+func GetEntities(b []byte, factory func() Entity) ([]Entity, error) {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(b, &raws); err != nil {
+		return nil, fmt.Errorf("GetEntities: %w", err)
+	}
+
+	entities := make([]Entity, 0, len(raws))
+	for i, raw := range raws {
+		e := factory()
+		if err := GetEntity(raw, e); err != nil {
+			return entities, fmt.Errorf("GetEntities: index %d: %w", i, err)
+		}
+		entities = append(entities, e)
+	}
+	return entities, nil
+}
+
+// 同じ Entity を使い回してデコードする。
+// json はキーが無いフィールドを書き換えないので、
+// 前回の値が残らないよう reflect でゼロ値に戻してからデコードする。
+func ResetAndDecode(b []byte, e Entity) error {
+	v := reflect.ValueOf(e)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+	return GetEntity(b, e)
+}
+
+func main19() {
+	users := `[
+		{"id": 1, "name": "Jxck", "lang": "ja"},
+		{"id": 2, "name": "john", "lang": "en"}
+	]`
+	entities, err := GetEntities([]byte(users), func() Entity { return &UserData{} })
+	if err != nil {
+		panic(err)
+	}
+	for _, e := range entities {
+		fmt.Println(*e.(*UserData))
+	}
+	// {1 Jxck  ja}
+	// {2 john  en}
+
+	// 一つの UserData を使い回す
+	u := &UserData{}
+	for _, s := range []string{`{"id": 1, "name": "Jxck", "lang": "ja"}`, `{"id": 2, "name": "john"}`} {
+		if err := ResetAndDecode([]byte(s), u); err != nil {
+			panic(err)
+		}
+		fmt.Println(*u)
+	}
+	// {1 Jxck  ja}
+	// {2 john  } 前回の lang は残らない
+
+	// 固定の JSON なら MustGetEntity で受け取れる
+	fixed := MustGetEntity([]byte(`{"id": 1, "name": "Jxck"}`), &UserData{}).(*UserData)
+	fmt.Println(fixed.Name) // Jxck
+	func() {
+		defer func() {
+			fmt.Println(recover()) // GetEntity: UserData: unexpected end of JSON input
+		}()
+		MustGetEntity([]byte(`{`), &UserData{})
+	}()
+}
+
+////////////////////////////
+
+/*
+	{"created_at": ...} が大量に並んだ配列を、
+	全部読み込まずに一つずつ処理する。
+	json.Decoder は Token() で配列の括弧を読み、
+	More() と Decode() で要素を一つずつ取り出せる。
+*/
+
+// r の JSON 配列から created_at を一つずつパースして fn に渡す。
+// fn がエラーを返したら、そこで止めてそのエラーを返す。
+func StreamTimestamps(r io.Reader, fn func(time.Time) error) error {
+	dec := json.NewDecoder(r)
+
+	if _, err := dec.Token(); err != nil { // [
+		return err
+	}
+	for dec.More() {
+		var v struct {
+			CreatedAt Timestamp `json:"created_at"`
+		}
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		if err := fn(time.Time(v.CreatedAt)); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil { // ]
+		return err
+	}
+	return nil
+}
+
+func main20() {
+	r := strings.NewReader(`[
+		{"created_at": "Thu May 31 00:00:01 +0000 2012"},
+		{"created_at": "Fri Jun 01 00:00:01 +0000 2012"},
+		{"created_at": "Sat Jun 02 00:00:01 +0000 2012"}
+	]`)
+	err := StreamTimestamps(r, func(t time.Time) error {
+		fmt.Println(t.Format("2006-01-02"))
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	// 2012-05-31
+	// 2012-06-01
+	// 2012-06-02
+}
+
+////////////////////////////
+
+/*
+	デコードした Entity を CSV に書き出す。
+	csv.Writer も io.Writer を受け取るので、
+	ファイルでもバッファでも標準出力でも同じように書ける。
+*/
+
+func WriteUserCSV(w io.Writer, users []UserData) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"id", "name", "time_zone", "lang"}); err != nil {
+		return err
+	}
+	for _, u := range users {
+		record := []string{strconv.Itoa(u.Id), u.Name, u.TimeZone, u.Lang}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// less で比べて最も大きいものを返す。空なら ok は false。
+// 同じ大きさのものが複数あれば、先にあるものを返す。
+func MaxBy[T any](items []T, less func(a, b T) bool) (T, bool) {
+	var max T
+	if len(items) == 0 {
+		return max, false
+	}
+	max = items[0]
+	for _, item := range items[1:] {
+		if less(max, item) {
+			max = item
+		}
+	}
+	return max, true
+}
+
+// less で比べて最も小さいものを返す。空なら ok は false。
+func MinBy[T any](items []T, less func(a, b T) bool) (T, bool) {
+	return MaxBy(items, func(a, b T) bool { return less(b, a) })
+}
+
+// 重複を取り除いたスライスを返す。順番は最初に出てきた順のまま。
+func Unique[T comparable](in []T) []T {
+	seen := make(map[T]bool, len(in))
+	out := make([]T, 0, len(in))
+	for _, v := range in {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// JSON にして戻すことで、 src とメモリを共有しない複製を作る。
+// JSON を経由するので、非公開フィールドや JSON にできない値(chan, func など)はコピーされない。
+func DeepCopy[T any](src T) (T, error) {
+	var dst T
+	b, err := json.Marshal(src)
+	if err != nil {
+		return dst, err
+	}
+	err = json.Unmarshal(b, &dst)
+	return dst, err
+}
+
+// 1 行目を見出しとして、 json タグと同じ名前の列を Employee の各フィールドに入れる。
+// 見出しに無いフィールドがあればエラーを返す。
+func EmployeesFromCSV(r io.Reader) ([]Employee, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[name] = i
+	}
+	t := reflect.TypeOf(Employee{})
+	index := make([]int, t.NumField())
+	for i := range index {
+		name := t.Field(i).Tag.Get("json")
+		col, ok := columns[name]
+		if !ok {
+			return nil, fmt.Errorf("EmployeesFromCSV: missing column %q", name)
+		}
+		index[i] = col
+	}
+
+	var employees []Employee
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var e Employee
+		v := reflect.ValueOf(&e).Elem()
+		for i, col := range index {
+			v.Field(i).SetString(record[col])
+		}
+		employees = append(employees, e)
+	}
+	return employees, nil
+}
+
+// key で取り出した値をキーにした map を作る。
+// 同じキーが複数あれば、後のものが残る。
+func IndexBy[T any, K comparable](items []T, key func(T) K) map[K]T {
+	index := make(map[K]T, len(items))
+	for _, item := range items {
+		index[key(item)] = item
+	}
+	return index
+}
+
+func main21() {
+	var users []UserData
+	err := json.Unmarshal([]byte(`[
+		{"id": 1, "name": "Jxck", "time_zone": "Tokyo", "lang": "ja"},
+		{"id": 2, "name": "john", "time_zone": "London", "lang": "en"}
+	]`), &users)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := WriteUserCSV(os.Stdout, users); err != nil {
+		panic(err)
+	}
+	// id,name,time_zone,lang
+	// 1,Jxck,Tokyo,ja
+	// 2,john,London,en
+
+	// Id で引けるようにする
+	users = append(users, UserData{Id: 1, Name: "Jxck2"})
+	byId := IndexBy(users, func(u UserData) int { return u.Id })
+	fmt.Println(len(byId), byId[1].Name) // 2 Jxck2
+
+	// 複製を変更しても元は変わらない
+	clone, err := DeepCopy(users[0])
+	if err != nil {
+		panic(err)
+	}
+	clone.Name = "changed"
+	fmt.Println(users[0].Name, clone.Name) // Jxck changed
+
+	// CSV から Employee を読む
+	employees, err := EmployeesFromCSV(strings.NewReader(
+		"dept,emp_name,emp_email\nHR,john,john@golang.com\nDev,jane,jane@golang.com\n"))
+	if err != nil {
+		panic(err)
+	}
+	b, _ := json.Marshal(employees)
+	fmt.Println(string(b))
+	// [{"emp_name":"john","emp_email":"john@golang.com","dept":"HR"},{"emp_name":"jane","emp_email":"jane@golang.com","dept":"Dev"}]
+
+	_, err = EmployeesFromCSV(strings.NewReader("emp_name,dept\njohn,HR\n"))
+	fmt.Println(err) // EmployeesFromCSV: missing column "emp_email"
+
+	// 最大、最小
+	top, _ := MaxBy([]CountData{{Followers_count: 10}, {Friends_count: 20}, {Listed_count: 5}},
+		func(a, b CountData) bool { return a.Total() < b.Total() })
+	origin := Point{0, 0}
+	nearest, _ := MinBy([]Point{{3, 4}, {1, 1}, {-2, 0}},
+		func(a, b Point) bool { return a.Distance(origin) < b.Distance(origin) })
+	fmt.Println(top.Total(), nearest) // 20 (1, 1)
+
+	fmt.Println(Unique([]int{3, 1, 3, 2, 1})) // [3 1 2]
+	fmt.Println(Unique([]string{"a", "b"}))   // [a b]
+}
+
+////////////////////////////
+
+/*
+	reflect で struct のフィールドをたどり、
+	Getter を実装しているものから GetText() を集める。
+*/
+
+func CollectTexts(v interface{}) []string {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var texts []string
+	for i := 0; i < rv.NumField(); i++ {
+		if !rv.Type().Field(i).IsExported() {
+			continue
+		}
+		f := rv.Field(i)
+		if IsNil(f.Interface()) {
+			continue
+		}
+
+		// Document のような値のフィールドは、ポインタレシーバの GetText を呼べるよう
+		// ポインタにコピーしてから調べる。
+		if f.Kind() != reflect.Ptr && f.Kind() != reflect.Interface {
+			p := reflect.New(f.Type())
+			p.Elem().Set(f)
+			f = p
+		}
+		if g, ok := f.Interface().(Getter); ok {
+			texts = append(texts, g.GetText())
+		}
+	}
+	return texts
+}
+
+func main22() {
+	var book = struct {
+		Cover   *Document
+		Chapter *ExtendedPage
+		Note    Document
+		Title   string
+	}{
+		Cover:   NewDocument("cover"),
+		Chapter: NewExtendedPage("chapter", 1),
+		Note:    *NewDocument("note"),
+		Title:   "title",
+	}
+	fmt.Println(CollectTexts(book)) // [cover 1 : chapter note]
+}
+
+////////////////////////////
+
+/*
+	UnmarshalJSON の実装が panic しても、
+	取り込み処理全体を止めないようにする。
+*/
+
+// e.UnmarshalJSON の panic を recover してエラーにする。
+func SafeUnmarshal(e Entity, b []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("SafeUnmarshal: %s: panic: %v", reflect.TypeOf(e), r)
+		}
+	}()
+	return e.UnmarshalJSON(b)
+}
+
+func main23() {
+	// panic しなければ、 UnmarshalJSON の結果がそのまま返る
+	var ts Timestamp
+	fmt.Println(SafeUnmarshal(&ts, []byte(`"Thu May 31 00:00:01 +0000 2012"`)), ts)
+	fmt.Println(SafeUnmarshal(&ts, []byte(`"`)))
+	// <nil> Thu May 31 00:00:01 +0000 2012
+	// unexpected end of JSON input
+
+	// 前後の " を確認せずに b[1:len(b)-1] とするような実装だと、
+	// 同じ入力で panic する代わりにエラーが返る(main_test.go を参照)。
+}
+
+////////////////////////////
+
+/*
+	メソッドを名前で呼ぶ。
+	簡単なスクリプトから Accessor を操作するような用途を想定して、
+	Accessor のメソッドだけを呼べるようにする。
+*/
+
+// a の method を args で呼び、戻り値を返す。
+// Accessor に無いメソッドや、引数の数・型が合わない場合はエラーを返す。
+// a が nil (nil ポインタを入れたものも含む)の場合もエラーにする。
+func Invoke(a Accessor, method string, args ...interface{}) ([]interface{}, error) {
+	if IsNil(a) {
+		return nil, fmt.Errorf("Invoke: nil Accessor")
+	}
+	if _, ok := accessorType.MethodByName(method); !ok {
+		return nil, fmt.Errorf("Invoke: Accessor has no method %q", method)
+	}
+	m := reflect.ValueOf(a).MethodByName(method)
+	mt := m.Type()
+
+	if len(args) != mt.NumIn() {
+		return nil, fmt.Errorf("Invoke: %s takes %d arguments, got %d", method, mt.NumIn(), len(args))
+	}
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		v := reflect.ValueOf(arg)
+		if !v.IsValid() || !v.Type().AssignableTo(mt.In(i)) {
+			return nil, fmt.Errorf("Invoke: %s argument %d must be %s, got %T", method, i, mt.In(i), arg)
+		}
+		in[i] = v
+	}
+
+	var results []interface{}
+	for _, out := range m.Call(in) {
+		results = append(results, out.Interface())
+	}
+	return results, nil
+}
+
+func main24() {
+	doc := &Document{}
+	fmt.Println(Invoke(doc, "SetText", "x")) // [] <nil>
+	fmt.Println(Invoke(doc, "GetText"))      // [x] <nil>
+
+	_, err := Invoke(doc, "Clone")
+	fmt.Println(err) // Invoke: Accessor has no method "Clone"
+	_, err = Invoke(doc, "SetText", 1)
+	fmt.Println(err) // Invoke: SetText argument 0 must be string, got int
+}
+
+////////////////////////////
+
+/*
+	知らないフィールドを含む JSON をエラーにする。
+
+	json.Decoder の DisallowUnknownFields() を使えばよいが、
+	UserData のように UnmarshalJSON を実装している型では、
+	その中で改めて json.Unmarshal しているので設定が伝わらない。
+	そこで、同じフィールドを持つメソッドの無い struct 型を reflect で作り、
+	そこにデコードしてから元の型に変換する。
+*/
+
+// v (struct へのポインタ) に、知らないフィールドを許さずにデコードする。
+// v の UnmarshalJSON は呼ばれない。
+// 非公開フィールドを持つ struct には使えない。
+func StrictUnmarshal(b []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("StrictUnmarshal: %T is not a pointer to struct", v)
+	}
+	t := rv.Elem().Type()
+
+	fields := make([]reflect.StructField, t.NumField())
+	for i := range fields {
+		f := t.Field(i)
+		if !f.IsExported() {
+			return fmt.Errorf("StrictUnmarshal: %s has unexported field %s", t, f.Name)
+		}
+		fields[i] = f
+	}
+	plain := reflect.New(reflect.StructOf(fields))
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(plain.Interface()); err != nil {
+		return err
+	}
+	rv.Elem().Set(plain.Elem().Convert(t))
+	return nil
+}
+
+// GetEntity と同じだが、知らないフィールドがあればエラーにする
+func GetEntityStrict(b []byte, e Entity) error {
+	if err := StrictUnmarshal(b, e); err != nil {
+		return &DecodeError{entityTypeName(e), err}
+	}
+	return afterDecode(e)
+}
+
+func main25() {
+	u := &UserData{}
+	fmt.Println(GetEntityStrict([]byte(`{"id": 1, "name": "Jxck"}`), u), *u) // <nil> {1 Jxck  }
+
+	err := GetEntityStrict([]byte(`{"id": 1, "name": "Jxck", "followers_count": 1620}`), &UserData{})
+	fmt.Println(err) // GetEntity: UserData: json: unknown field "followers_count"
+}
+
+////////////////////////////
+
+/*
+	Accessor の text に、変換を順番にかける。
+*/
+
+type AccessorPipeline struct {
+	stages []func(string) string
+}
+
+// 変換を最後に追加する。 Use を続けて書けるよう、自身を返す。
+func (p *AccessorPipeline) Use(stage func(string) string) *AccessorPipeline {
+	p.stages = append(p.stages, stage)
+	return p
+}
+
+// a の text を読み、追加した順に変換して SetText で書き戻す。
+func (p *AccessorPipeline) Run(a Accessor) {
+	text := a.GetText()
+	for _, stage := range p.stages {
+		text = stage(text)
+	}
+	a.SetText(text)
+}
+
+func main26() {
+	doc := NewDocument("  pipeline  ")
+
+	var p AccessorPipeline
+	p.Use(strings.ToUpper).Use(strings.TrimSpace)
+	p.Run(doc)
+	fmt.Printf("%q\n", doc.GetText()) // "PIPELINE"
 }
 
 func main() {
@@ -558,4 +2724,28 @@ func main() {
 	main13()
 	fmt.Println(">--main14------------<")
 	main14()
+	fmt.Println(">--main15------------<")
+	main15()
+	fmt.Println(">--main16------------<")
+	main16()
+	fmt.Println(">--main17------------<")
+	main17()
+	fmt.Println(">--main18------------<")
+	main18()
+	fmt.Println(">--main19------------<")
+	main19()
+	fmt.Println(">--main20------------<")
+	main20()
+	fmt.Println(">--main21------------<")
+	main21()
+	fmt.Println(">--main22------------<")
+	main22()
+	fmt.Println(">--main23------------<")
+	main23()
+	fmt.Println(">--main24------------<")
+	main24()
+	fmt.Println(">--main25------------<")
+	main25()
+	fmt.Println(">--main26------------<")
+	main26()
 }
@@ -0,0 +1,1975 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTimestampRoundTrip(t *testing.T) {
+	var val map[string]Timestamp
+	if err := json.Unmarshal([]byte(JSONString), &val); err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// JSONString は空白を含むので、詰めたものと比べる
+	var want bytes.Buffer
+	if err := json.Compact(&want, []byte(JSONString)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("got %s, want %s", got, want.Bytes())
+	}
+}
+
+func TestTimestampUnmarshalNullAndEmpty(t *testing.T) {
+	for _, in := range []string{`null`, `""`} {
+		var ts Timestamp
+		if err := ts.UnmarshalJSON([]byte(in)); err != nil {
+			t.Errorf("%s: unexpected error %v", in, err)
+		}
+		if !time.Time(ts).IsZero() {
+			t.Errorf("%s: got %v, want zero value", in, ts)
+		}
+	}
+}
+
+func TestTimestampUnmarshalMalformed(t *testing.T) {
+	var ts Timestamp
+	if err := ts.UnmarshalJSON([]byte(`12345`)); err == nil {
+		t.Error("expected error for a non-string value")
+	}
+}
+
+func TestTimestampLayouts(t *testing.T) {
+	want := time.Date(2012, 5, 31, 0, 0, 1, 0, time.UTC)
+	for _, in := range []string{
+		`{"created_at": "Thu May 31 00:00:01 +0000 2012"}`,
+		`{"created_at": "2012-05-31T00:00:01Z"}`,
+		`{"created_at": "Thu, 31 May 2012 00:00:01 +0000"}`,
+	} {
+		var m map[string]Timestamp
+		if err := json.Unmarshal([]byte(in), &m); err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if got := time.Time(m["created_at"]); !got.Equal(want) {
+			t.Errorf("%s: got %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestPointArithmetic(t *testing.T) {
+	a, b := Point{2, 3}, Point{1, 1}
+
+	if got := a.Add(b); got != (Point{3, 4}) {
+		t.Errorf("Add: got %v", got)
+	}
+	if got := a.Sub(b); got != (Point{1, 2}) {
+		t.Errorf("Sub: got %v", got)
+	}
+	if got := a.Scale(2); got != (Point{4, 6}) {
+		t.Errorf("Scale: got %v", got)
+	}
+
+	// 値渡しなので元の Point は変わらない
+	if a != (Point{2, 3}) || b != (Point{1, 1}) {
+		t.Errorf("operands mutated: a=%v b=%v", a, b)
+	}
+}
+
+func TestPointDistance(t *testing.T) {
+	tests := []struct {
+		p, q Point
+		want float64
+	}{
+		{Point{0, 0}, Point{3, 4}, 5},
+		{Point{3, 4}, Point{0, 0}, 5},
+		{Point{-1, -1}, Point{2, 3}, 5},
+		{Point{2, 3}, Point{2, 3}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Distance(tt.q); got != tt.want {
+			t.Errorf("%v.Distance(%v) = %v, want %v", tt.p, tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestPointString(t *testing.T) {
+	if got := fmt.Sprintf("%v", Point{2, 3}); got != "(2, 3)" {
+		t.Errorf("got %q", got)
+	}
+	if got := (Point{2, 3}).Coordinate(); got != "(2, 3)" {
+		t.Errorf("Coordinate: got %q", got)
+	}
+}
+
+func TestTrimTo(t *testing.T) {
+	tests := []struct {
+		in   trimmedString
+		want trimmedString
+	}{
+		{"abcdefg", "abc"},
+		{"ab", "ab"},
+		{"漢字表記", "漢字表"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.TrimTo(3); got != tt.want {
+			t.Errorf("%q.TrimTo(3) = %q, want %q", tt.in, got, tt.want)
+		}
+		if got := tt.in.trim(); got != tt.want {
+			t.Errorf("%q.trim() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestToAny(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []interface{}
+		want []interface{}
+	}{
+		{"int", ToAny([]int{1, 2, 3}), []interface{}{1, 2, 3}},
+		{"string", ToAny([]string{"one", "two"}), []interface{}{"one", "two"}},
+		{"empty", ToAny([]string{}), []interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("ToAny() = %#v, want %#v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+// f の実行中に os.Stdout へ書かれた内容を返す
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	f()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestPrintAllT(t *testing.T) {
+	xs := []string{"one", "two", "three"}
+	want := captureStdout(t, func() { PrintAll(ToAny(xs)) })
+	got := captureStdout(t, func() { PrintAllT(xs) })
+	if got != want {
+		t.Errorf("PrintAllT printed %q, PrintAll printed %q", got, want)
+	}
+	if want != "one\ntwo\nthree\n" {
+		t.Errorf("PrintAll printed %q", want)
+	}
+}
+
+func TestGetEntityInvalidJSON(t *testing.T) {
+	err := GetEntity([]byte(`{"id": `), &UserData{})
+	if err == nil {
+		t.Fatal("GetEntity succeeded on invalid JSON")
+	}
+	for _, want := range []string{"GetEntity", "UserData"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+}
+
+// main12 の EntityString と同じもの
+const entityJSON = `{
+	"id":51442629,
+	"name":"Jxck",
+	"followers_count":1620,
+	"friends_count":617,
+	"listed_count":204,
+	"favourites_count":2895,
+	"time_zone":"Tokyo",
+	"statuses_count":17387,
+	"lang":"ja"
+}`
+
+func TestUserDataJSONUnmarshal(t *testing.T) {
+	var u UserData
+	if err := json.Unmarshal([]byte(entityJSON), &u); err != nil {
+		t.Fatal(err)
+	}
+	want := UserData{Id: 51442629, Name: "Jxck", TimeZone: "Tokyo", Lang: "ja"}
+	if u != want {
+		t.Errorf("json.Unmarshal = %+v, want %+v", u, want)
+	}
+}
+
+func TestDecodeEntity(t *testing.T) {
+	RegisterEntity("user", func() Entity { return &UserData{} })
+	RegisterEntity("count", func() Entity { return &CountData{} })
+
+	stream := []string{
+		`{"type": "user", "id": 1, "name": "Jxck"}`,
+		`{"type": "count", "followers_count": 1620}`,
+	}
+	want := []Entity{
+		&UserData{Id: 1, Name: "Jxck"},
+		&CountData{Followers_count: 1620},
+	}
+	for i, s := range stream {
+		got, err := DecodeEntity([]byte(s))
+		if err != nil {
+			t.Fatalf("DecodeEntity(%s): %v", s, err)
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("DecodeEntity(%s) = %#v, want %#v", s, got, want[i])
+		}
+	}
+
+	// GetEntity を通るので、 UserData の検証も行われる
+	if _, err := DecodeEntity([]byte(`{"type": "user", "name": "Jxck"}`)); err == nil {
+		t.Error("DecodeEntity accepted a user without id")
+	}
+
+	_, err := DecodeEntity([]byte(`{"type": "tweet"}`))
+	if err == nil || !strings.Contains(err.Error(), `"tweet"`) {
+		t.Errorf("DecodeEntity with unknown type returned %v", err)
+	}
+}
+
+func TestTypedValue(t *testing.T) {
+	// Get() の戻り値をそのまま int, string の変数に入れられる
+	var n int = TypedValue[int]{10}.Get()
+	if n != 10 {
+		t.Errorf("TypedValue[int].Get() = %d, want 10", n)
+	}
+	var s string = TypedValue[string]{"vvv"}.Get()
+	if s != "vvv" {
+		t.Errorf("TypedValue[string].Get() = %q, want %q", s, "vvv")
+	}
+}
+
+func TestAsGetter(t *testing.T) {
+	ep := NewExtendedPage("page", 3)
+	g, ok := AsGetter(ep)
+	if !ok {
+		t.Fatal("AsGetter(*ExtendedPage) returned false")
+	}
+	if got := g.GetText(); got != "3 : page" {
+		t.Errorf("GetText() = %q, want %q", got, "3 : page")
+	}
+	if !IsGetter(ep) {
+		t.Error("IsGetter(*ExtendedPage) = false")
+	}
+
+	if g, ok := AsGetter("string"); ok || g != nil {
+		t.Errorf("AsGetter(string) = %v, %v", g, ok)
+	}
+	if IsGetter("string") {
+		t.Error("IsGetter(string) = true")
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"Getter", NewExtendedPage("page", 3), "Getter: 3 : page"},
+		{"string", "str", "string: str"},
+		{"int", 42, "int: 42"},
+		{"float64", 1.5, "float64: 1.5"},
+		{"bool", true, "bool: true"},
+		{"untyped nil", nil, "nil"},
+		{"typed nil Getter", (*ExtendedPage)(nil), "Getter: <nil>"},
+		{"default", Point{1, 2}, "unknown: main.Point"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Describe(tt.v); got != tt.want {
+				t.Errorf("Describe(%#v) = %q, want %q", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessorEqual(t *testing.T) {
+	doc := NewDocument("page")
+	page := NewPage("page", 1)
+	if !AccessorEqual(doc, page) {
+		t.Error("Document and Page with the same text are not equal")
+	}
+
+	// ExtendedPage は GetText() に Page を含めるので、 text が同じでも等しくない
+	ep := NewExtendedPage("page", 2)
+	if AccessorEqual(doc, ep) {
+		t.Errorf("AccessorEqual(%q, %q) = true", doc.GetText(), ep.GetText())
+	}
+	if AccessorEqual(ep, NewExtendedPage("page", 3)) {
+		t.Error("ExtendedPages with different page numbers are equal")
+	}
+}
+
+func TestUserDataTimeZoneTag(t *testing.T) {
+	var u UserData
+	if err := GetEntity([]byte(entityJSON), &u); err != nil {
+		t.Fatal(err)
+	}
+	if u.TimeZone != "Tokyo" {
+		t.Errorf("TimeZone = %q, want %q", u.TimeZone, "Tokyo")
+	}
+}
+
+func TestGetEntityValidate(t *testing.T) {
+	if err := GetEntity([]byte(`{"id": 1, "name": "Jxck"}`), &UserData{}); err != nil {
+		t.Errorf("valid payload: %v", err)
+	}
+
+	err := GetEntity([]byte(`{"id": 0, "name": "Jxck"}`), &UserData{})
+	if err == nil || !strings.Contains(err.Error(), "id is required") {
+		t.Errorf("id 0: got %v, want id is required", err)
+	}
+}
+
+func TestStructTags(t *testing.T) {
+	want := map[string]string{"Name": "emp_name", "Email": "emp_email", "Dept": "dept"}
+	if got := StructTags(Employee{}, "json"); !reflect.DeepEqual(got, want) {
+		t.Errorf("StructTags(Employee) = %v, want %v", got, want)
+	}
+
+	// 非公開フィールドは飛ばし、 struct 以外は空の map
+	for _, v := range []interface{}{TaggedStruct{}, 42, nil} {
+		if got := StructTags(v, "tag"); len(got) != 0 {
+			t.Errorf("StructTags(%#v) = %v, want empty", v, got)
+		}
+	}
+}
+
+func TestFirstFieldTag(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		key  string
+		want string
+	}{
+		{"TaggedStruct", TaggedStruct{}, "tag", "tag1"},
+		{"missing key", TaggedStruct{}, "json", ""},
+		{"Employee", Employee{}, "json", "emp_name"},
+		{"nil", nil, "json", ""},
+		{"not a struct", 42, "json", ""},
+		{"no fields", struct{}{}, "json", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := firstFieldTag(tt.v, tt.key); got != tt.want {
+				t.Errorf("firstFieldTag(%#v, %q) = %q, want %q", tt.v, tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldTagValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		v         interface{}
+		field     string
+		key       string
+		want      string
+		wantFound bool
+	}{
+		{"unexported field", TaggedStruct{}, "field", "tag", "tag1", true},
+		{"exported field", Employee{}, "Name", "json", "emp_name", true},
+		{"missing field", Employee{}, "Age", "json", "", false},
+		{"missing tag", Employee{}, "Name", "xml", "", false},
+		{"not a struct", "str", "Name", "json", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := FieldTagValue(tt.v, tt.field, tt.key)
+			if got != tt.want || ok != tt.wantFound {
+				t.Errorf("FieldTagValue(%#v, %q, %q) = %q, %v, want %q, %v",
+					tt.v, tt.field, tt.key, got, ok, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestPutEntityRoundTrip(t *testing.T) {
+	var in UserData
+	if err := GetEntity([]byte(entityJSON), &in); err != nil {
+		t.Fatal(err)
+	}
+	b, err := PutEntity(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out UserData
+	if err := GetEntity(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Id != in.Id {
+		t.Errorf("Id after round trip = %d, want %d", out.Id, in.Id)
+	}
+}
+
+func TestCountDataTotal(t *testing.T) {
+	d := CountData{1620, 617, 204, 2895, 17387}
+	if got := d.Total(); got != 22723 {
+		t.Errorf("Total() = %d, want 22723", got)
+	}
+	if got := (CountData{}).Total(); got != 0 {
+		t.Errorf("zero Total() = %d, want 0", got)
+	}
+}
+
+func TestCountDataSliceSort(t *testing.T) {
+	s := CountDataSlice{
+		{Followers_count: 1},
+		{Followers_count: 10, Statuses_count: 5},
+		{Friends_count: 3},
+	}
+	sort.Sort(s)
+
+	want := []int{15, 3, 1}
+	for i, d := range s {
+		if d.Total() != want[i] {
+			t.Errorf("s[%d].Total() = %d, want %d", i, d.Total(), want[i])
+		}
+	}
+}
+
+func TestDecodeEntityFrom(t *testing.T) {
+	var u UserData
+	if err := DecodeEntityFrom(strings.NewReader(entityJSON), &u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Id != 51442629 || u.Name != "Jxck" {
+		t.Errorf("DecodeEntityFrom = %+v", u)
+	}
+
+	if err := DecodeEntityFrom(strings.NewReader(`{"id":`), &UserData{}); err == nil {
+		t.Error("DecodeEntityFrom succeeded on truncated JSON")
+	}
+}
+
+func TestEntityFromRequest(t *testing.T) {
+	var got UserData
+	var gotErr error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = UserData{}
+		gotErr = EntityFromRequest(r, &got)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(entityJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if gotErr != nil {
+		t.Fatal(gotErr)
+	}
+	if got.Id != 51442629 || got.TimeZone != "Tokyo" {
+		t.Errorf("EntityFromRequest = %+v", got)
+	}
+
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(`{"id": 0, "name": "Jxck"}`))
+	if err := EntityFromRequest(req, &UserData{}); err == nil {
+		t.Error("EntityFromRequest accepted an invalid user")
+	}
+}
+
+func TestPrintAllTo(t *testing.T) {
+	var buf bytes.Buffer
+	PrintAllTo(&buf, []interface{}{"one", "two", "three"})
+	if got, want := buf.String(), "one\ntwo\nthree\n"; got != want {
+		t.Errorf("PrintAllTo wrote %q, want %q", got, want)
+	}
+}
+
+func TestFilterByType(t *testing.T) {
+	vals := []GetValuer{NewValue(1), NewValue("a"), NewValue(2), NewValue(nil), NewValue("b")}
+	if got, want := FilterByType[int](vals), []int{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterByType[int] = %v, want %v", got, want)
+	}
+	if got, want := FilterByType[string](vals), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterByType[string] = %v, want %v", got, want)
+	}
+}
+
+func TestNormalizeJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want interface{}
+	}{
+		{"integral", `{"n": 3}`, int64(3)},
+		{"fraction", `{"n": 3.5}`, 3.5},
+		{"negative", `{"n": -2}`, int64(-2)},
+		{"min int64", `{"n": -9223372036854775808}`, int64(math.MinInt64)},
+		{"above max int64", `{"n": 1e19}`, 1e19},
+		{"below min int64", `{"n": -1e19}`, -1e19},
+		{"nested", `{"n": {"m": [1, 1.5]}}`, map[string]interface{}{"m": []interface{}{int64(1), 1.5}}},
+		{"string", `{"n": "3"}`, "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.in), &v); err != nil {
+				t.Fatal(err)
+			}
+			got := NormalizeJSON(v).(map[string]interface{})["n"]
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeJSON(%s)[n] = %#v, want %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeJSONInPlace(t *testing.T) {
+	v := map[string]interface{}{"n": 3.0}
+	NormalizeJSON(v)
+	if _, ok := v["n"].(int64); !ok {
+		t.Errorf("map was not modified in place: %#v", v)
+	}
+}
+
+func TestMethodNames(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want []string
+	}{
+		{"*Document", &Document{}, []string{"Clone", "GetText", "Key", "SetText", "WithText"}},
+		{"*ExtendedPage", &ExtendedPage{}, []string{"BaseText", "Clone", "GetText", "Key", "SetText", "UnmarshalJSON", "WithText"}},
+		{"Document", Document{}, []string{}},
+		{"nil", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MethodNames(tt.v)
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("MethodNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImplements(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want bool
+	}{
+		{"*ExtendedPage", &ExtendedPage{}, true},
+		{"string", "string", false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Implements(tt.v, GetterType); got != tt.want {
+				t.Errorf("Implements(%#v, GetterType) = %v, want %v", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimestampEqualAndString(t *testing.T) {
+	var a, b Timestamp
+	for _, ts := range []*Timestamp{&a, &b} {
+		if err := ts.UnmarshalJSON([]byte(`"Thu May 31 00:00:01 +0000 2012"`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !a.Equal(b) {
+		t.Errorf("%v and %v are not Equal", a, b)
+	}
+	if a.String() != b.String() {
+		t.Errorf("String() differs: %q, %q", a.String(), b.String())
+	}
+	if want := "Thu May 31 00:00:01 +0000 2012"; a.String() != want {
+		t.Errorf("String() = %q, want %q", a.String(), want)
+	}
+
+	// 別のタイムゾーンで表しても同じ時刻なら Equal
+	jst := time.FixedZone("JST", 9*60*60)
+	if !a.In(jst).Equal(a) {
+		t.Error("Equal reported a different instant after In")
+	}
+}
+
+// Document をポインタで埋め込んだもの
+type pointerPage struct {
+	*Document
+	Page int
+}
+
+// ポインタで埋め込んだ上で GetText をオーバーライドしたもの
+type pointerExtendedPage struct {
+	*Document
+	Page int
+}
+
+func (p *pointerExtendedPage) GetText() string {
+	return fmt.Sprintf("%d : %s", p.Page, p.Document.GetText())
+}
+
+func TestIsMethodPromoted(t *testing.T) {
+	tests := []struct {
+		name   string
+		v      interface{}
+		method string
+		want   bool
+	}{
+		{"Page", &Page{}, "GetText", true},
+		{"ExtendedPage", &ExtendedPage{}, "GetText", false},
+		{"embedded pointer", &pointerPage{}, "GetText", true},
+		{"embedded pointer overridden", &pointerExtendedPage{}, "GetText", false},
+		{"defined on Document", &Document{}, "GetText", false},
+		{"missing method", &Page{}, "Missing", false},
+		{"nil", nil, "GetText", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsMethodPromoted(tt.v, tt.method); got != tt.want {
+				t.Errorf("IsMethodPromoted(%T, %q) = %v, want %v", tt.v, tt.method, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValues(t *testing.T) {
+	in := []Any{10, "vvv", nil, Point{2, 3}}
+	vals := Values(in...)
+	if len(vals) != len(in) {
+		t.Fatalf("len(Values()) = %d, want %d", len(vals), len(in))
+	}
+	for i, v := range vals {
+		if got := v.GetValue(); got != in[i] {
+			t.Errorf("vals[%d].GetValue() = %v, want %v", i, got, in[i])
+		}
+	}
+}
+
+func TestGetEntityCtx(t *testing.T) {
+	var u UserData
+	if err := GetEntityCtx(context.Background(), strings.NewReader(entityJSON), &u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Id != 51442629 {
+		t.Errorf("Id = %d, want 51442629", u.Id)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := GetEntityCtx(ctx, strings.NewReader(entityJSON), &UserData{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("GetEntityCtx with cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestDump(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"Point", Point{2, 3}, "main.Point{(2, 3)} (main.Point)"},
+		{"string", "str", "string{str} (string)"},
+		{"nil", nil, "<nil>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Dump(tt.v); got != tt.want {
+				t.Errorf("Dump(%#v) = %q, want %q", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func newUserData() Entity { return &UserData{} }
+
+func TestGetEntities(t *testing.T) {
+	users := `[
+		{"id": 1, "name": "Jxck", "lang": "ja"},
+		{"id": 2, "name": "john", "lang": "en"}
+	]`
+	entities, err := GetEntities([]byte(users), newUserData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Entity{
+		&UserData{Id: 1, Name: "Jxck", Lang: "ja"},
+		&UserData{Id: 2, Name: "john", Lang: "en"},
+	}
+	if !reflect.DeepEqual(entities, want) {
+		t.Errorf("GetEntities = %v, want %v", entities, want)
+	}
+}
+
+func TestGetEntitiesPartial(t *testing.T) {
+	users := `[{"id": 1, "name": "Jxck"}, {"id": 0, "name": "john"}, {"id": 3, "name": "x"}]`
+	entities, err := GetEntities([]byte(users), newUserData)
+	if err == nil || !strings.Contains(err.Error(), "index 1") {
+		t.Fatalf("GetEntities error = %v, want one mentioning index 1", err)
+	}
+	if len(entities) != 1 {
+		t.Errorf("got %d entities before the failure, want 1", len(entities))
+	}
+}
+
+func TestResetAndDecode(t *testing.T) {
+	u := &UserData{}
+	if err := ResetAndDecode([]byte(`{"id": 1, "name": "Jxck", "lang": "ja"}`), u); err != nil {
+		t.Fatal(err)
+	}
+	if err := ResetAndDecode([]byte(`{"id": 2, "name": "john"}`), u); err != nil {
+		t.Fatal(err)
+	}
+	// 前回の Lang は残らない
+	if want := (UserData{Id: 2, Name: "john"}); *u != want {
+		t.Errorf("ResetAndDecode = %+v, want %+v", *u, want)
+	}
+}
+
+// 毎回 UserData を作ってデコードする
+func BenchmarkGetEntityNew(b *testing.B) {
+	payload := []byte(entityJSON)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := GetEntity(payload, &UserData{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// 一つの UserData を使い回してデコードする
+func BenchmarkResetAndDecode(b *testing.B) {
+	payload := []byte(entityJSON)
+	u := &UserData{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := ResetAndDecode(payload, u); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestConcat(t *testing.T) {
+	tests := []struct {
+		name      string
+		accessors []Accessor
+		want      string
+	}{
+		{"none", nil, ""},
+		{"one", []Accessor{NewDocument("a")}, "a"},
+		{"three", []Accessor{NewDocument("a"), NewPage("b", 1), NewExtendedPage("c", 2)}, "a, b, 2 : c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Concat(", ", tt.accessors...); got != tt.want {
+				t.Errorf("Concat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// UnmarshalJSON を直接呼ぶと、 json.Unmarshal の構文チェックを通らない値も渡ってくる。
+// どんな入力でも panic せず、成功するかエラーを返すことを確認する。
+func FuzzTimestampUnmarshal(f *testing.F) {
+	for _, seed := range []string{
+		`"Thu May 31 00:00:01 +0000 2012"`,
+		`"2012-05-31T00:00:01Z"`,
+		`null`,
+		`""`,
+		`"`,
+		``,
+		`"Thu May 31`,
+		`12345`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var ts Timestamp
+		if err := ts.UnmarshalJSON(b); err != nil {
+			return
+		}
+		// 成功したものは MarshalJSON で戻せる
+		if _, err := ts.MarshalJSON(); err != nil {
+			t.Errorf("MarshalJSON after UnmarshalJSON(%q): %v", b, err)
+		}
+	})
+}
+
+func TestTryAssert(t *testing.T) {
+	if g, ok := TryAssert[Getter](NewDocument("doc")); !ok || g.GetText() != "doc" {
+		t.Errorf("TryAssert[Getter](*Document) = %v, %v", g, ok)
+	}
+	if n, ok := TryAssert[int]("str"); ok || n != 0 {
+		t.Errorf("TryAssert[int](string) = %v, %v", n, ok)
+	}
+	if g, ok := TryAssert[Getter](nil); ok || g != nil {
+		t.Errorf("TryAssert[Getter](nil) = %v, %v", g, ok)
+	}
+}
+
+func TestMustAssert(t *testing.T) {
+	if got := MustAssert[int](42); got != 42 {
+		t.Errorf("MustAssert[int](42) = %d", got)
+	}
+
+	tests := []struct {
+		name string
+		f    func()
+		want string
+	}{
+		{"wrong type", func() { MustAssert[Getter]("str") }, "MustAssert: want iface.Getter, got string"},
+		{"nil", func() { MustAssert[Getter](nil) }, "MustAssert: want iface.Getter, got <nil>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if got := recover(); got != tt.want {
+					t.Errorf("panic = %v, want %q", got, tt.want)
+				}
+			}()
+			tt.f()
+		})
+	}
+}
+
+const timestampArray = `[
+	{"created_at": "Thu May 31 00:00:01 +0000 2012"},
+	{"created_at": "Fri Jun 01 00:00:01 +0000 2012"},
+	{"created_at": "Sat Jun 02 00:00:01 +0000 2012"}
+]`
+
+func TestStreamTimestamps(t *testing.T) {
+	var got []string
+	err := StreamTimestamps(strings.NewReader(timestampArray), func(t time.Time) error {
+		got = append(got, t.Format("2006-01-02"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2012-05-31", "2012-06-01", "2012-06-02"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("StreamTimestamps = %v, want %v", got, want)
+	}
+}
+
+func TestStreamTimestampsStopsOnError(t *testing.T) {
+	stop := errors.New("stop")
+	calls := 0
+	err := StreamTimestamps(strings.NewReader(timestampArray), func(time.Time) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("StreamTimestamps = %v, want %v", err, stop)
+	}
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+}
+
+func TestReduce(t *testing.T) {
+	sum := func(acc int, v Any) int {
+		if n, ok := v.(int); ok {
+			return acc + n
+		}
+		return acc
+	}
+	join := func(acc string, v Any) string {
+		s, ok := v.(string)
+		if !ok {
+			return acc
+		}
+		if acc == "" {
+			return s
+		}
+		return acc + "," + s
+	}
+
+	vals := Values(1, "a", 2, "b", 3)
+	if got := Reduce(vals, 0, sum); got != 6 {
+		t.Errorf("sum = %d, want 6", got)
+	}
+	if got := Reduce(vals, "", join); got != "a,b" {
+		t.Errorf("join = %q, want %q", got, "a,b")
+	}
+	if got := Reduce(nil, 10, sum); got != 10 {
+		t.Errorf("Reduce on empty slice = %d, want init 10", got)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	want := time.Date(2012, 5, 31, 0, 0, 1, 0, time.UTC)
+	for _, in := range []string{
+		`"Thu May 31 00:00:01 +0000 2012"`,
+		`Thu May 31 00:00:01 +0000 2012`,
+		`"2012-05-31T00:00:01Z"`,
+	} {
+		got, err := ParseTimestamp([]byte(in))
+		if err != nil {
+			t.Errorf("ParseTimestamp(%s): %v", in, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("ParseTimestamp(%s) = %v, want %v", in, got, want)
+		}
+	}
+
+	for _, in := range []string{`"Thu May 31"`, `not a date`, ``} {
+		if _, err := ParseTimestamp([]byte(in)); err == nil {
+			t.Errorf("ParseTimestamp(%q) succeeded", in)
+		}
+	}
+}
+
+func TestIsNil(t *testing.T) {
+	var nilDoc Accessor = (*Document)(nil)
+	tests := []struct {
+		name string
+		v    interface{}
+		want bool
+	}{
+		{"untyped nil", nil, true},
+		{"nil *Document in Accessor", nilDoc, true},
+		{"nil slice", []int(nil), true},
+		{"nil map", map[string]int(nil), true},
+		{"*Document", NewDocument("doc"), false},
+		{"int", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsNil(tt.v); got != tt.want {
+				t.Errorf("IsNil(%#v) = %v, want %v", tt.v, got, tt.want)
+			}
+		})
+	}
+
+	// interface 自体は nil ではない
+	if nilDoc == nil {
+		t.Error("Accessor holding a nil *Document compares equal to nil")
+	}
+}
+
+func TestTagMismatches(t *testing.T) {
+	want := map[string]string{"Name": "emp_name", "Email": "emp_email"}
+	if got := TagMismatches(Employee{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("TagMismatches(Employee) = %v, want %v", got, want)
+	}
+	// time_zone 以外はフィールド名と大文字小文字違いなので含まれない
+	if got, want := TagMismatches(UserData{}), map[string]string{"TimeZone": "time_zone"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("TagMismatches(UserData) = %v, want %v", got, want)
+	}
+}
+
+func TestOrderedValues(t *testing.T) {
+	var o OrderedValues
+	o.Set("b", 1)
+	o.Set("a", 2)
+	o.Set("c", 3)
+	o.Set("a", 20) // 上書きしても順番は変わらない
+
+	if got, want := o.Keys(), []string{"b", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+	if v, ok := o.Get("a"); !ok || v != 20 {
+		t.Errorf("Get(a) = %v, %v, want 20, true", v, ok)
+	}
+	if v, ok := o.Get("missing"); ok || v != nil {
+		t.Errorf("Get(missing) = %v, %v", v, ok)
+	}
+
+	// Keys() の戻り値を書き換えても中身は変わらない
+	o.Keys()[0] = "x"
+	if got := o.Keys()[0]; got != "b" {
+		t.Errorf("Keys()[0] = %q after modifying a returned slice", got)
+	}
+}
+
+func TestDecodeErrorAs(t *testing.T) {
+	err := GetEntity([]byte(`{"followers_count": "many"}`), &CountData{})
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("GetEntity error %v is not a *DecodeError", err)
+	}
+	if de.Type != "CountData" {
+		t.Errorf("DecodeError.Type = %q, want %q", de.Type, "CountData")
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("DecodeError does not unwrap to the json error: %v", err)
+	}
+}
+
+func TestFindFirst(t *testing.T) {
+	accessors := []Accessor{NewDocument("doc"), NewExtendedPage("page", 1), NewDocument("page")}
+	contains := func(text string) bool { return strings.Contains(text, "page") }
+
+	found, ok := FindFirst(accessors, contains)
+	if !ok {
+		t.Fatal("FindFirst found nothing")
+	}
+	if found != accessors[1] {
+		t.Errorf("FindFirst = %q, want the ExtendedPage", found.GetText())
+	}
+
+	if found, ok := FindFirst(accessors[:1], contains); ok || found != nil {
+		t.Errorf("FindFirst without a match = %v, %v", found, ok)
+	}
+}
+
+func TestAssignableTo(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to interface{}
+		want     bool
+	}{
+		{"Document to Page", Document{}, Page{}, false},
+		{"Page to Document", Page{}, Document{}, false},
+		{"Document to Document", Document{}, Document{}, true},
+		{"*Document to *Page", &Document{}, &Page{}, false},
+		// to に interface の変数を渡しても、比べられるのは中身の動的な型になる
+		{"*Document to Accessor holding *Page", &Document{}, Accessor(&Page{}), false},
+		{"nil", nil, Document{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AssignableTo(tt.from, tt.to); got != tt.want {
+				t.Errorf("AssignableTo(%T, %T) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeVerbose(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    string
+		wantLog string
+	}{
+		{"Getter", NewExtendedPage("page", 3), "3 : page", "matched Getter"},
+		{"string", "str", "not implemented", "matched string"},
+		{"int", 42, "", "no match for type int"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs []string
+			logf := func(format string, args ...interface{}) {
+				logs = append(logs, fmt.Sprintf(format, args...))
+			}
+			if got := DescribeVerbose(tt.v, logf); got != tt.want {
+				t.Errorf("DescribeVerbose() = %q, want %q", got, tt.want)
+			}
+			if len(logs) != 1 || logs[0] != tt.wantLog {
+				t.Errorf("logged %q, want [%q]", logs, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestMethodSetKinds(t *testing.T) {
+	valueMethods, pointerMethods := MethodSetKinds(Document{})
+	if len(valueMethods) != 0 {
+		t.Errorf("value method set of Document = %v, want empty", valueMethods)
+	}
+	want := []string{"Clone", "GetText", "Key", "SetText", "WithText"}
+	if !reflect.DeepEqual(pointerMethods, want) {
+		t.Errorf("pointer method set of Document = %v, want %v", pointerMethods, want)
+	}
+
+	// ポインタを渡しても同じ結果になる
+	v2, p2 := MethodSetKinds(&Document{})
+	if !reflect.DeepEqual(v2, valueMethods) || !reflect.DeepEqual(p2, pointerMethods) {
+		t.Errorf("MethodSetKinds(*Document) = %v, %v", v2, p2)
+	}
+
+	// Point は値レシーバなので、どちらにも含まれる
+	pv, pp := MethodSetKinds(Point{})
+	for _, m := range []string{"Add", "String"} {
+		if !containsString(pv, m) || !containsString(pp, m) {
+			t.Errorf("%s missing from Point method sets: %v, %v", m, pv, pp)
+		}
+	}
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMemoize(t *testing.T) {
+	counter := &countingValue{}
+	memo := Memoize(counter)
+	for i := 0; i < 10; i++ {
+		if got := memo.GetValue(); got != 1 {
+			t.Fatalf("GetValue() = %v, want 1", got)
+		}
+	}
+	if counter.calls != 1 {
+		t.Errorf("underlying GetValue called %d times, want 1", counter.calls)
+	}
+}
+
+// 呼ばれた回数を数える GetValuer
+type countingValue struct {
+	calls int
+}
+
+func (c *countingValue) GetValue() Any {
+	c.calls++
+	return c.calls
+}
+
+func TestWriteUserCSV(t *testing.T) {
+	var users []UserData
+	err := json.Unmarshal([]byte(`[
+		{"id": 1, "name": "Jxck", "time_zone": "Tokyo", "lang": "ja"},
+		{"id": 2, "name": "john, jr.", "time_zone": "London", "lang": "en"}
+	]`), &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		users []UserData
+		want  string
+	}{
+		{"users", users, "id,name,time_zone,lang\n1,Jxck,Tokyo,ja\n2,\"john, jr.\",London,en\n"},
+		{"empty", nil, "id,name,time_zone,lang\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteUserCSV(&buf, tt.users); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("WriteUserCSV wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexBy(t *testing.T) {
+	users := []UserData{
+		{Id: 1, Name: "Jxck"},
+		{Id: 2, Name: "john"},
+		{Id: 1, Name: "Jxck2"},
+	}
+	index := IndexBy(users, func(u UserData) int { return u.Id })
+	if len(index) != 2 {
+		t.Errorf("len(index) = %d, want 2", len(index))
+	}
+	// 同じキーは後のものが残る
+	if got := index[1].Name; got != "Jxck2" {
+		t.Errorf("index[1].Name = %q, want %q", got, "Jxck2")
+	}
+	if got := index[2].Name; got != "john" {
+		t.Errorf("index[2].Name = %q, want %q", got, "john")
+	}
+}
+
+func TestAccessorFunc(t *testing.T) {
+	var text string
+	acsr := AccessorFunc(
+		func() string { return text },
+		func(t string) { text = t },
+	)
+
+	out := captureStdout(t, func() { SetAndGet(acsr) })
+	if out != "accessor\n" {
+		t.Errorf("SetAndGet printed %q, want %q", out, "accessor\n")
+	}
+	if text != "accessor" {
+		t.Errorf("backing variable = %q, want %q", text, "accessor")
+	}
+}
+
+func TestJSONFields(t *testing.T) {
+	type inner struct {
+		A string `json:"a"`
+		B string
+	}
+	type outer struct {
+		inner
+		C    string `json:"-"`
+		D    int    `json:"d,omitempty"`
+		priv string
+	}
+
+	tests := []struct {
+		name string
+		v    interface{}
+		want []string
+	}{
+		{"Employee", Employee{}, []string{"emp_name", "emp_email", "dept"}},
+		{"*Employee", &Employee{}, []string{"emp_name", "emp_email", "dept"}},
+		// Document の text は非公開なので、 Page 自身のフィールドだけになる
+		{"Page", Page{}, []string{"Page"}},
+		{"pointer embedded", pointerPage{}, []string{"Page"}},
+		{"embedded", outer{}, []string{"a", "B", "d"}},
+		{"not a struct", 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := JSONFields(tt.v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("JSONFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeepCopy(t *testing.T) {
+	src := UserData{Id: 1, Name: "Jxck", TimeZone: "Tokyo", Lang: "ja"}
+	dst, err := DeepCopy(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst != src {
+		t.Errorf("DeepCopy = %+v, want %+v", dst, src)
+	}
+
+	dst.Name = "changed"
+	if src.Name != "Jxck" {
+		t.Errorf("source changed to %q after modifying the copy", src.Name)
+	}
+
+	// 非公開フィールドは JSON を通らないので残らない
+	page, err := DeepCopy(*NewPage("page", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Page != 2 || page.GetText() != "" {
+		t.Errorf("DeepCopy(Page) = %d %q, want 2 \"\"", page.Page, page.GetText())
+	}
+}
+
+func TestValueTypeNamePoint(t *testing.T) {
+	if got := NewValue(Point{2, 3}).TypeName(); got != "main.Point" {
+		t.Errorf("TypeName() = %q, want %q", got, "main.Point")
+	}
+}
+
+func TestSetAll(t *testing.T) {
+	doc, page := &Document{}, &Page{}
+	SetAll("all", doc, page)
+	if doc.GetText() != "all" || page.GetText() != "all" {
+		t.Errorf("after SetAll: %q, %q", doc.GetText(), page.GetText())
+	}
+
+	// 引数が無くても何もしない
+	SetAll("none")
+}
+
+func TestZip(t *testing.T) {
+	pairs, err := Zip([]Any{"a", "b"}, []Any{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GetValuer{&Pair{"a", 1}, &Pair{"b", 2}}
+	if !reflect.DeepEqual(pairs, want) {
+		t.Errorf("Zip = %v, want %v", pairs, want)
+	}
+	if got := pairs[1].GetValue(); got != 2 {
+		t.Errorf("pairs[1].GetValue() = %v, want 2", got)
+	}
+
+	if pairs, err := Zip([]Any{"a"}, []Any{1, 2}); err == nil || pairs != nil {
+		t.Errorf("Zip with mismatched lengths = %v, %v", pairs, err)
+	}
+}
+
+func TestTimestampWithoutZone(t *testing.T) {
+	var ts Timestamp
+	if err := ts.UnmarshalJSON([]byte(`"Thu May 31 00:00:01 2012"`)); err != nil {
+		t.Fatal(err)
+	}
+	got := time.Time(ts)
+	if got.Location() != time.UTC {
+		t.Errorf("Location() = %v, want UTC", got.Location())
+	}
+	if want := time.Date(2012, 5, 31, 0, 0, 1, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCollectTexts(t *testing.T) {
+	type book struct {
+		Cover   *Document
+		Chapter *ExtendedPage
+		Note    Document
+		Back    Accessor
+		Missing *Document
+		Title   string
+		hidden  *Document
+	}
+	b := book{
+		Cover:   NewDocument("cover"),
+		Chapter: NewExtendedPage("chapter", 1),
+		Note:    *NewDocument("note"),
+		Back:    NewPage("back", 9),
+		Title:   "title",
+		hidden:  NewDocument("hidden"),
+	}
+
+	want := []string{"cover", "1 : chapter", "note", "back"}
+	if got := CollectTexts(b); !reflect.DeepEqual(got, want) {
+		t.Errorf("CollectTexts(book) = %q, want %q", got, want)
+	}
+	if got := CollectTexts(&b); !reflect.DeepEqual(got, want) {
+		t.Errorf("CollectTexts(&book) = %q, want %q", got, want)
+	}
+	if got := CollectTexts("str"); got != nil {
+		t.Errorf("CollectTexts(string) = %q, want nil", got)
+	}
+}
+
+// json.Marshal が入れ子の map でもキーをソートすることに頼っているので、それを確認しておく
+func TestMarshalSortsNestedMapKeys(t *testing.T) {
+	m1 := map[string]interface{}{"b": 1, "a": map[string]interface{}{"y": 2, "x": 3}}
+	m2 := map[string]interface{}{"a": map[string]interface{}{"x": 3, "y": 2}, "b": 1}
+	b1, err := json.Marshal(NormalizeJSON(m1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := json.Marshal(NormalizeJSON(m2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":{"x":3,"y":2},"b":1}`; string(b1) != want || !bytes.Equal(b1, b2) {
+		t.Errorf("json.Marshal = %s and %s, want %s", b1, b2, want)
+	}
+}
+
+// 最初の Timestamp と同じく、前後の " を確認せずに取り除く実装
+type naiveTimestamp time.Time
+
+func (t *naiveTimestamp) UnmarshalJSON(b []byte) error {
+	v, err := time.Parse(time.RubyDate, string(b[1:len(b)-1]))
+	if err != nil {
+		return err
+	}
+	*t = naiveTimestamp(v)
+	return nil
+}
+
+func TestSafeUnmarshal(t *testing.T) {
+	var nt naiveTimestamp
+	err := SafeUnmarshal(&nt, []byte(`"`))
+	if err == nil {
+		t.Fatal("SafeUnmarshal returned nil for a panicking UnmarshalJSON")
+	}
+	if !strings.Contains(err.Error(), "panic: runtime error: slice bounds out of range") {
+		t.Errorf("SafeUnmarshal error = %q", err)
+	}
+
+	// panic しなければ UnmarshalJSON の結果をそのまま返す
+	if err := SafeUnmarshal(&nt, []byte(`"Thu May 31 00:00:01 +0000 2012"`)); err != nil {
+		t.Errorf("SafeUnmarshal on valid input: %v", err)
+	}
+	var ts Timestamp
+	if err := SafeUnmarshal(&ts, []byte(`12345`)); err == nil || strings.Contains(err.Error(), "panic") {
+		t.Errorf("SafeUnmarshal(Timestamp, 12345) = %v, want the plain json error", err)
+	}
+}
+
+func TestContainsAndIndexOfAny(t *testing.T) {
+	haystack := []Any{1, "two", Point{2, 3}, []int{4}}
+	tests := []struct {
+		name   string
+		needle Any
+		want   int
+	}{
+		{"int", 1, 0},
+		{"string", "two", 1},
+		{"Point", Point{2, 3}, 2},
+		{"slice", []int{4}, 3},
+		{"missing", Point{3, 2}, -1},
+		{"different type", "1", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IndexOfAny(haystack, tt.needle); got != tt.want {
+				t.Errorf("IndexOfAny(%v) = %d, want %d", tt.needle, got, tt.want)
+			}
+			if got := ContainsAny(haystack, tt.needle); got != (tt.want >= 0) {
+				t.Errorf("ContainsAny(%v) = %v", tt.needle, got)
+			}
+		})
+	}
+}
+
+func TestOnDecode(t *testing.T) {
+	type call struct {
+		typeName string
+		fields   int
+	}
+	var calls []call
+	OnDecode = func(typeName string, fields int) {
+		calls = append(calls, call{typeName, fields})
+	}
+	defer func() { OnDecode = nil }()
+
+	if err := GetEntity([]byte(entityJSON), &UserData{}); err != nil {
+		t.Fatal(err)
+	}
+	// 失敗したときは呼ばれない
+	GetEntity([]byte(`{"id":`), &UserData{})
+
+	want := []call{{"UserData", 4}}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("OnDecode calls = %v, want %v", calls, want)
+	}
+}
+
+func TestBoundingBox(t *testing.T) {
+	tests := []struct {
+		name     string
+		points   []Point
+		min, max Point
+		ok       bool
+	}{
+		{"empty", nil, Point{}, Point{}, false},
+		{"single", []Point{{2, 3}}, Point{2, 3}, Point{2, 3}, true},
+		{"several", []Point{{2, 3}, {-1, 5}, {4, 0}}, Point{-1, 0}, Point{4, 5}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			min, max, ok := BoundingBox(tt.points)
+			if min != tt.min || max != tt.max || ok != tt.ok {
+				t.Errorf("BoundingBox(%v) = %v, %v, %v, want %v, %v, %v",
+					tt.points, min, max, ok, tt.min, tt.max, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMustGetEntity(t *testing.T) {
+	u := &UserData{}
+	if got := MustGetEntity([]byte(entityJSON), u); got != Entity(u) {
+		t.Errorf("MustGetEntity returned %v, want the entity passed in", got)
+	}
+	if u.Id != 51442629 {
+		t.Errorf("Id = %d, want 51442629", u.Id)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("MustGetEntity did not panic on malformed JSON")
+		}
+	}()
+	MustGetEntity([]byte(`{"id":`), &UserData{})
+}
+
+func TestCanConvertSlice(t *testing.T) {
+	stringType := reflect.TypeOf("")
+	anyType := reflect.TypeOf((*interface{})(nil)).Elem()
+	tests := []struct {
+		name     string
+		from, to reflect.Type
+		want     bool
+	}{
+		{"string to interface{}", stringType, anyType, false},
+		{"interface{} to interface{}", anyType, anyType, true},
+		{"string to string", stringType, stringType, true},
+		{"*Document to Accessor", reflect.TypeOf(&Document{}), accessorType, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanConvertSlice(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanConvertSlice(%v, %v) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmployeesFromCSV(t *testing.T) {
+	// 列の順番はタグの順と違っていてもよい
+	in := "dept,emp_name,emp_email\nsales,john,john@example.com\ndev,jane,jane@example.com\n"
+	got, err := EmployeesFromCSV(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Employee{
+		{Name: "john", Email: "john@example.com", Dept: "sales"},
+		{Name: "jane", Email: "jane@example.com", Dept: "dev"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EmployeesFromCSV = %+v, want %+v", got, want)
+	}
+
+	_, err = EmployeesFromCSV(strings.NewReader("emp_name,emp_email\njohn,john@example.com\n"))
+	if err == nil || !strings.Contains(err.Error(), `missing column "dept"`) {
+		t.Errorf("missing column error = %v", err)
+	}
+}
+
+func TestOverriddenMethods(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want []string
+	}{
+		{"ExtendedPage", &ExtendedPage{}, []string{"Clone", "GetText", "WithText"}},
+		{"Page", &Page{}, []string{"Clone", "WithText"}},
+		{"embedded pointer", &pointerPage{}, []string{}},
+		{"embedded pointer overridden", &pointerExtendedPage{}, []string{"GetText"}},
+		{"not a struct", "str", nil},
+		{"nil", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OverriddenMethods(tt.v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("OverriddenMethods(%T) = %#v, want %#v", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTagMapping(t *testing.T) {
+	in := map[string]interface{}{"emp_name": "john", "other": 1}
+	got := ApplyTagMapping(Employee{}, in)
+	want := map[string]interface{}{"Name": "john", "other": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ApplyTagMapping = %v, want %v", got, want)
+	}
+	// 元の map は変えない
+	if _, ok := in["emp_name"]; !ok || len(in) != 2 {
+		t.Errorf("input map was modified: %v", in)
+	}
+}
+
+func TestGroupByType(t *testing.T) {
+	got := GroupByType(Values(1, "a", 2, "b"))
+	want := map[string][]Any{
+		"int":    {1, 2},
+		"string": {"a", "b"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupByType = %v, want %v", got, want)
+	}
+
+	if got := GroupByType(Values(nil)); len(got["<nil>"]) != 1 {
+		t.Errorf("GroupByType(nil) = %v, want one <nil> entry", got)
+	}
+}
+
+func TestTimestampIn(t *testing.T) {
+	var ts Timestamp
+	if err := ts.UnmarshalJSON([]byte(`"Thu May 31 00:00:01 +0000 2012"`)); err != nil {
+		t.Fatal(err)
+	}
+	tokyo := time.FixedZone("JST", 9*60*60)
+	jst := time.Time(ts.In(tokyo))
+	if got := jst.Hour() - time.Time(ts).Hour(); got != 9 {
+		t.Errorf("hour shifted by %d, want 9", got)
+	}
+	if !ts.In(tokyo).Equal(ts) {
+		t.Error("In changed the instant")
+	}
+}
+
+func TestMaxByMinBy(t *testing.T) {
+	counts := []CountData{
+		{Followers_count: 1},
+		{Followers_count: 10, Statuses_count: 5},
+		{Friends_count: 15},
+	}
+	byTotal := func(a, b CountData) bool { return a.Total() < b.Total() }
+	// 同じ大きさなら先にあるもの
+	if got, ok := MaxBy(counts, byTotal); !ok || got != counts[1] {
+		t.Errorf("MaxBy(counts) = %v, %v, want %v", got, ok, counts[1])
+	}
+
+	points := []Point{{3, 4}, {-1, 1}, {0, -2}}
+	nearer := func(a, b Point) bool { return a.Distance(Point{}) < b.Distance(Point{}) }
+	if got, ok := MinBy(points, nearer); !ok || got != (Point{-1, 1}) {
+		t.Errorf("MinBy(points) = %v, %v, want (-1, 1)", got, ok)
+	}
+
+	if _, ok := MaxBy([]Point(nil), nearer); ok {
+		t.Error("MaxBy(empty) ok = true")
+	}
+	if _, ok := MinBy([]Point(nil), nearer); ok {
+		t.Error("MinBy(empty) ok = true")
+	}
+}
+
+func TestInvoke(t *testing.T) {
+	doc := &Document{}
+	if out, err := Invoke(doc, "SetText", "x"); err != nil || len(out) != 0 {
+		t.Fatalf("Invoke(SetText) = %v, %v", out, err)
+	}
+	out, err := Invoke(doc, "GetText")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, []interface{}{"x"}) {
+		t.Errorf("Invoke(GetText) = %v, want [x]", out)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		args   []interface{}
+		want   string
+	}{
+		{"unknown method", "Clone", nil, `Invoke: Accessor has no method "Clone"`},
+		{"wrong count", "SetText", nil, "Invoke: SetText takes 1 arguments, got 0"},
+		{"wrong type", "SetText", []interface{}{1}, "Invoke: SetText argument 0 must be string, got int"},
+		{"nil argument", "SetText", []interface{}{nil}, "Invoke: SetText argument 0 must be string, got <nil>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Invoke(doc, tt.method, tt.args...)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("Invoke error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	for _, a := range []Accessor{nil, (*Document)(nil)} {
+		if _, err := Invoke(a, "GetText"); err == nil || err.Error() != "Invoke: nil Accessor" {
+			t.Errorf("Invoke(%#v) error = %v, want %q", a, err, "Invoke: nil Accessor")
+		}
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	doc := NewDocument("frozen")
+	var g interface{} = Freeze(doc)
+	if _, ok := g.(Getter); !ok {
+		t.Fatal("Freeze result is not a Getter")
+	}
+	if _, ok := g.(Accessor); ok {
+		t.Error("Freeze result can be asserted back to Accessor")
+	}
+
+	// 元の Accessor の変更は見える
+	doc.SetText("changed")
+	if got := g.(Getter).GetText(); got != "changed" {
+		t.Errorf("GetText() = %q, want %q", got, "changed")
+	}
+}
+
+func TestGetEntityStrict(t *testing.T) {
+	var decoded []string
+	OnDecode = func(typeName string, fields int) { decoded = append(decoded, typeName) }
+	defer func() { OnDecode = nil }()
+
+	if err := GetEntityStrict([]byte(`{"id": 1, "name": "Jxck"}`), &UserData{}); err != nil {
+		t.Errorf("known fields only: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"unknown field", `{"id": 1, "name": "Jxck", "followers_count": 1}`, `unknown field "followers_count"`},
+		{"invalid", `{"id": 0, "name": "Jxck"}`, "id is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := GetEntityStrict([]byte(tt.in), &UserData{})
+			var de *DecodeError
+			if !errors.As(err, &de) || de.Type != "UserData" {
+				t.Fatalf("GetEntityStrict error = %v, want a UserData DecodeError", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("GetEntityStrict error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+
+	// OnDecode は成功したときだけ呼ばれる
+	if !reflect.DeepEqual(decoded, []string{"UserData"}) {
+		t.Errorf("OnDecode calls = %v, want [UserData]", decoded)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	vals := Values(1, "a", 2.5, "b", 3)
+	isNumber := func(v Any) bool {
+		switch v.(type) {
+		case int, float64:
+			return true
+		}
+		return false
+	}
+	match, rest := Partition(vals, isNumber)
+
+	values := func(gs []GetValuer) []Any {
+		out := make([]Any, len(gs))
+		for i, g := range gs {
+			out[i] = g.GetValue()
+		}
+		return out
+	}
+	if got, want := values(match), []Any{1, 2.5, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("match = %v, want %v", got, want)
+	}
+	if got, want := values(rest), []Any{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rest = %v, want %v", got, want)
+	}
+}
+
+func TestCountDataMerge(t *testing.T) {
+	a := CountData{Followers_count: 1, Listed_count: 2}
+	b := CountData{Followers_count: 2, Statuses_count: 3}
+	if got, want := a.Merge(b), (CountData{Followers_count: 3, Listed_count: 2, Statuses_count: 3}); got != want {
+		t.Errorf("Merge = %v, want %v", got, want)
+	}
+}
+
+func TestSumCounts(t *testing.T) {
+	got := SumCounts(CountData{1620, 617, 204, 2895, 17387}, CountData{}, CountData{Statuses_count: 13})
+	if want := (CountData{1620, 617, 204, 2895, 17400}); got != want {
+		t.Errorf("SumCounts = %v, want %v", got, want)
+	}
+	if got := SumCounts(); got != (CountData{}) {
+		t.Errorf("SumCounts() = %v, want zero", got)
+	}
+}
+
+func TestJSONDiff(t *testing.T) {
+	a := Employee{Name: "john", Email: "john@example.com", Dept: "sales"}
+	b := a
+	b.Dept = "dev"
+
+	got, err := JSONDiff(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]interface{}{"dept": {"sales", "dev"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSONDiff = %v, want %v", got, want)
+	}
+
+	if got, err := JSONDiff(a, a); err != nil || len(got) != 0 {
+		t.Errorf("JSONDiff(a, a) = %v, %v, want empty", got, err)
+	}
+}
+
+func TestZeroFields(t *testing.T) {
+	var u UserData
+	if err := json.Unmarshal([]byte(`{"name":"x"}`), &u); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"id", "time_zone", "lang"}
+	if got := ZeroFields(u); !reflect.DeepEqual(got, want) {
+		t.Errorf("ZeroFields = %v, want %v", got, want)
+	}
+	if got := ZeroFields(&u); !reflect.DeepEqual(got, want) {
+		t.Errorf("ZeroFields(pointer) = %v, want %v", got, want)
+	}
+	if got := ZeroFields(1); got != nil {
+		t.Errorf("ZeroFields(int) = %v, want nil", got)
+	}
+}
+
+func TestTweetCreatedAt(t *testing.T) {
+	var tw Tweet
+	if err := json.Unmarshal([]byte(JSONString), &tw); err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2012, 5, 31, 0, 0, 1, 0, time.UTC)
+	if got := time.Time(tw.CreatedAt); !got.Equal(want) {
+		t.Errorf("CreatedAt = %v, want %v", got, want)
+	}
+}
+
+func TestUnique(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []int
+		want []int
+	}{
+		{"repeats", []int{3, 1, 3, 2, 1}, []int{3, 1, 2}},
+		{"no duplicates", []int{1, 2, 3}, []int{1, 2, 3}},
+		{"empty", []int{}, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unique(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unique(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingMethods(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want []string
+	}{
+		{"full implementer", &Document{}, []string{}},
+		{"partial", Freeze(&Document{}), []string{"SetText"}},
+		{"value receiver", Document{}, []string{"GetText", "SetText"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MissingMethods(tt.v, accessorType)
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("MissingMethods(%T) = %v, want %v", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessorPipeline(t *testing.T) {
+	doc := NewDocument("  pipeline  ")
+	var p AccessorPipeline
+	p.Use(strings.ToUpper).Use(strings.TrimSpace)
+	p.Run(doc)
+	if got := doc.GetText(); got != "PIPELINE" {
+		t.Errorf("GetText() = %q, want %q", got, "PIPELINE")
+	}
+
+	// 追加した順に適用される
+	var order AccessorPipeline
+	order.Use(func(s string) string { return s + "a" }).Use(func(s string) string { return s + "b" })
+	order.Run(doc)
+	if got := doc.GetText(); got != "PIPELINEab" {
+		t.Errorf("GetText() = %q, want %q", got, "PIPELINEab")
+	}
+
+	// 変換が無ければそのまま
+	var empty AccessorPipeline
+	empty.Run(doc)
+	if got := doc.GetText(); got != "PIPELINEab" {
+		t.Errorf("empty pipeline changed text to %q", got)
+	}
+}
+
+func TestToMap(t *testing.T) {
+	got := ToMap(Values(1, "a", Point{2, 3}, "1"), func(v Any) string { return fmt.Sprint(v) })
+	// 1 と "1" はどちらも "1" になり、後のものが残る
+	want := map[string]Any{"1": "1", "a": "a", "(2, 3)": Point{2, 3}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ToMap = %v, want %v", got, want)
+	}
+}
+
+func TestUserDataNullID(t *testing.T) {
+	var u UserData
+	if err := json.Unmarshal([]byte(`{"id":null,"name":"x"}`), &u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Id != 0 || u.Name != "x" {
+		t.Errorf("got %+v, want Id 0 and Name x", u)
+	}
+}
+
+func TestDynamicIfMixed(t *testing.T) {
+	vals := []interface{}{NewDocument("a"), "string", NewExtendedPage("b", 1), 1, Freeze(NewDocument("c"))}
+	want := []string{"a", "not implemented", "1 : b", "not implemented", "c"}
+	for i, v := range vals {
+		if got := dynamicIf(v); got != want[i] {
+			t.Errorf("dynamicIf(%T) = %q, want %q", v, got, want[i])
+		}
+	}
+}
+
+// 同じ型の値が大量に流れてくる場合の、型アサーションと reflect 、自前のキャッシュでの判定の比較
+func BenchmarkAsGetter(b *testing.B) {
+	vals := []interface{}{NewDocument("a"), "string", NewExtendedPage("b", 1), 1}
+
+	b.Run("assertion", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if g, ok := AsGetter(vals[i%len(vals)]); ok {
+				g.GetText()
+			}
+		}
+	})
+	b.Run("reflect", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			v := vals[i%len(vals)]
+			if Implements(v, GetterType) {
+				v.(Getter).GetText()
+			}
+		}
+	})
+	// reflect.Type ごとに結果を覚えておく、自前のキャッシュ
+	b.Run("cache", func(b *testing.B) {
+		var mu sync.RWMutex
+		cache := map[reflect.Type]bool{}
+		isGetter := func(v interface{}) bool {
+			t := reflect.TypeOf(v)
+			mu.RLock()
+			ok, found := cache[t]
+			mu.RUnlock()
+			if found {
+				return ok
+			}
+			ok = IsGetter(v)
+			mu.Lock()
+			cache[t] = ok
+			mu.Unlock()
+			return ok
+		}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			v := vals[i%len(vals)]
+			if isGetter(v) {
+				v.(Getter).GetText()
+			}
+		}
+	})
+}
+
+func TestStructString(t *testing.T) {
+	john := Employee{Name: "john", Email: "john@example.com", Dept: "sales"}
+	want := "emp_name:  john\n" +
+		"emp_email: john@example.com\n" +
+		"dept:      sales\n"
+	if got := StructString(john); got != want {
+		t.Errorf("StructString(Employee) =\n%s\nwant\n%s", got, want)
+	}
+	if got := StructString(&john); got != want {
+		t.Errorf("StructString(*Employee) =\n%s\nwant\n%s", got, want)
+	}
+	if got := StructString(42); got != "42" {
+		t.Errorf("StructString(42) = %q, want %q", got, "42")
+	}
+}